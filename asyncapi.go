@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// asyncapiMaxDepth bounds the $ref chains and the schema nesting followed to generate an example.
+const asyncapiMaxDepth = 10
+
+// asyncapiBinding is the message and channel binding holding the EventBridge attributes of events.
+const asyncapiBinding = "eventbridge"
+
+// asyncapiSpec is an AsyncAPI 2.x or 3.x document, kept untyped to follow its $ref.
+// https://www.asyncapi.com/docs/reference/specification/latest
+type asyncapiSpec struct {
+	file    string
+	root    map[string]any
+	version int // major version
+}
+
+// asyncapiMessage is a message of a channel and the names it can be selected by.
+type asyncapiMessage struct {
+	names   []string
+	channel map[string]any
+	message map[string]any
+}
+
+// asyncapi://spec.yaml/channel/message, the message can be omitted when the channel has a single one
+func dataFromAsyncAPI(apipath string) (string, string, error) {
+	spec, msg, err := loadAsyncAPIMessage(apipath)
+	if err != nil {
+		return "", "", err
+	}
+
+	var pattern struct {
+		Source     []any `json:"source,omitempty"`
+		DetailType []any `json:"detail-type,omitempty"`
+	}
+	for _, a := range []struct {
+		field, binding string
+		values         *[]any
+	}{{"source", "source", &pattern.Source}, {"detail-type", "detailType", &pattern.DetailType}} {
+		values, _, err := spec.attribute(msg, a.binding, a.field)
+		if err != nil {
+			return "", "", err
+		}
+		*a.values = values
+	}
+	if len(pattern.Source) == 0 && len(pattern.DetailType) == 0 {
+		return "", "", fmt.Errorf("message %s has no source nor detail-type, set them in its %s bindings or its headers const or enum", msg.names[0], asyncapiBinding)
+	}
+
+	b, err := json.Marshal(pattern)
+	if err != nil {
+		return "", "", err
+	}
+
+	bus, err := spec.eventBus(msg)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), bus, nil
+}
+
+// eventFromAsyncAPI generates an input event from the headers and payload schema of a message.
+func eventFromAsyncAPI(apipath string) (string, error) {
+	spec, msg, err := loadAsyncAPIMessage(apipath)
+	if err != nil {
+		return "", err
+	}
+
+	var event inputEvent
+	for _, a := range []struct {
+		field, binding string
+		value          *string
+	}{{"source", "source", &event.Source}, {"detail-type", "detailType", &event.DetailType}} {
+		_, example, err := spec.attribute(msg, a.binding, a.field)
+		if err != nil {
+			return "", err
+		}
+		s, ok := example.(string)
+		if !ok || s == "" {
+			return "", fmt.Errorf("message %s has no %s, set it in its %s bindings or its headers", msg.names[0], a.field, asyncapiBinding)
+		}
+		*a.value = s
+	}
+
+	payload, err := spec.payloadSchema(msg)
+	if err != nil {
+		return "", err
+	}
+	detail, err := spec.example(payload, 0)
+	if err != nil {
+		return "", fmt.Errorf("message %s payload: %w", msg.names[0], err)
+	}
+	if detail == nil {
+		detail = map[string]any{}
+	}
+	if _, ok := detail.(map[string]any); !ok {
+		return "", fmt.Errorf("message %s payload is not an object, EventBridge event details are JSON objects", msg.names[0])
+	}
+
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return "", err
+	}
+	event.Detail = string(b)
+
+	b, err = json.Marshal(event)
+	return string(b), err
+}
+
+// loadAsyncAPIMessage reads the spec and selects the message of the source path.
+func loadAsyncAPIMessage(apipath string) (*asyncapiSpec, asyncapiMessage, error) {
+	file, refs, err := splitTemplatePath(strings.TrimPrefix(apipath, "asyncapi://"))
+	if err != nil {
+		return nil, asyncapiMessage{}, err
+	}
+	if len(refs) == 0 {
+		return nil, asyncapiMessage{}, fmt.Errorf("invalid asyncapi source %q, expected asyncapi://<spec>/<channel>[/<message>]", apipath)
+	}
+
+	spec, err := loadAsyncAPI(file)
+	if err != nil {
+		return nil, asyncapiMessage{}, err
+	}
+
+	// channel addresses can have slashes, the last part is the message when the full path isn't a channel
+	name, messageName := strings.Join(refs, "/"), ""
+	channel, ok := spec.channel(name)
+	if !ok && len(refs) > 1 {
+		name, messageName = strings.Join(refs[:len(refs)-1], "/"), refs[len(refs)-1]
+		channel, ok = spec.channel(name)
+	}
+	if !ok {
+		channels, _ := spec.root["channels"].(map[string]any)
+		return nil, asyncapiMessage{}, fmt.Errorf("channel %s not found in %s, choose one of: %s", name, file, strings.Join(slices.Sorted(maps.Keys(channels)), ", "))
+	}
+
+	messages, err := spec.channelMessages(channel)
+	if err != nil {
+		return nil, asyncapiMessage{}, fmt.Errorf("channel %s: %w", name, err)
+	}
+	choices := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if messageName != "" && slices.Contains(m.names, messageName) {
+			return spec, m, nil
+		}
+		choices = append(choices, m.names[0])
+	}
+	slices.Sort(choices)
+
+	switch {
+	case len(messages) == 0:
+		return nil, asyncapiMessage{}, fmt.Errorf("channel %s has no message", name)
+	case messageName != "":
+		return nil, asyncapiMessage{}, fmt.Errorf("channel %s has no message %s, choose one of: %s", name, messageName, strings.Join(choices, ", "))
+	case len(messages) > 1:
+		return nil, asyncapiMessage{}, fmt.Errorf("channel %s has %d messages, choose one of: %s", name, len(messages), strings.Join(choices, ", "))
+	}
+	return spec, messages[0], nil
+}
+
+func loadAsyncAPI(file string) (*asyncapiSpec, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON documents are valid YAML
+	var root map[string]any
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, fmt.Errorf("invalid AsyncAPI document %s: %w", file, err)
+	}
+
+	version, _ := root["asyncapi"].(string)
+	switch {
+	case strings.HasPrefix(version, "2."):
+		return &asyncapiSpec{file: file, root: root, version: 2}, nil
+	case strings.HasPrefix(version, "3."):
+		return &asyncapiSpec{file: file, root: root, version: 3}, nil
+	}
+	return nil, fmt.Errorf("%s has unsupported AsyncAPI version %q, expected 2.x or 3.x", file, version)
+}
+
+// channel finds a channel by key, or by address in AsyncAPI 3 where channels are keyed by id.
+func (s *asyncapiSpec) channel(name string) (map[string]any, bool) {
+	channels, _ := s.root["channels"].(map[string]any)
+	for key, c := range channels {
+		v, err := s.deref(c)
+		if err != nil {
+			continue
+		}
+		channel, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		// 2.x addresses often start with a slash
+		if key == name || key == "/"+name {
+			return channel, true
+		}
+		if address, _ := channel["address"].(string); s.version == 3 && address != "" && (address == name || address == "/"+name) {
+			return channel, true
+		}
+	}
+	return nil, false
+}
+
+// channelMessages lists the messages of the channel operations in 2.x, or of the channel in 3.x.
+func (s *asyncapiSpec) channelMessages(channel map[string]any) ([]asyncapiMessage, error) {
+	type entry struct {
+		key string
+		raw any
+	}
+	var entries []entry
+
+	if s.version == 2 {
+		for _, op := range []string{"publish", "subscribe"} {
+			operation, _ := channel[op].(map[string]any)
+			if operation == nil {
+				continue
+			}
+			v, err := s.deref(operation["message"])
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := v.(map[string]any); ok {
+				if oneOf, ok := m["oneOf"].([]any); ok {
+					for _, raw := range oneOf {
+						entries = append(entries, entry{raw: raw})
+					}
+					continue
+				}
+			}
+			entries = append(entries, entry{raw: operation["message"]})
+		}
+	} else {
+		messages, _ := channel["messages"].(map[string]any)
+		for _, key := range slices.Sorted(maps.Keys(messages)) {
+			entries = append(entries, entry{key: key, raw: messages[key]})
+		}
+	}
+
+	var messages []asyncapiMessage
+	seen := map[string]bool{}
+	for _, e := range entries {
+		v, err := s.deref(e.raw)
+		if err != nil {
+			return nil, err
+		}
+		message, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var names []string
+		var ref string
+		if m, ok := e.raw.(map[string]any); ok {
+			ref, _ = m["$ref"].(string)
+		}
+		messageID, _ := message["messageId"].(string)
+		name, _ := message["name"].(string)
+		for _, n := range []string{e.key, ref[strings.LastIndex(ref, "/")+1:], messageID, name} {
+			if n != "" && !slices.Contains(names, n) {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			names = []string{fmt.Sprintf("#%d", len(messages)+1)}
+		}
+
+		// 2.x channels can publish and subscribe the same message
+		if seen[names[0]] {
+			continue
+		}
+		seen[names[0]] = true
+		messages = append(messages, asyncapiMessage{names: names, channel: channel, message: message})
+	}
+	return messages, nil
+}
+
+// attribute returns the values allowed for an event field, source or detail-type, and the value of
+// the example event, from the message then the channel bindings, or the message headers schema.
+func (s *asyncapiSpec) attribute(msg asyncapiMessage, binding, header string) ([]any, any, error) {
+	for _, owner := range []map[string]any{msg.message, msg.channel} {
+		b, err := s.binding(owner)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch v := b[binding].(type) {
+		case string:
+			return []any{v}, v, nil
+		case []any:
+			if len(v) > 0 {
+				return v, v[0], nil
+			}
+		}
+	}
+
+	v, err := s.deref(msg.message["headers"])
+	if err != nil {
+		return nil, nil, err
+	}
+	headers, _ := v.(map[string]any)
+	properties, _ := headers["properties"].(map[string]any)
+	if properties == nil {
+		return nil, nil, nil
+	}
+
+	// detailType as in the bindings, as headers can't always have dashes
+	for _, name := range []string{header, binding} {
+		v, err := s.deref(properties[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		schema, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		var values []any
+		if c, ok := schema["const"]; ok {
+			values = []any{c}
+		} else if enum, ok := schema["enum"].([]any); ok {
+			values = enum
+		}
+		example, err := s.example(schema, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf("message %s header %s: %w", msg.names[0], name, err)
+		}
+		return values, example, nil
+	}
+	return nil, nil, nil
+}
+
+// eventBus returns the bus of the message or channel bindings, if any.
+func (s *asyncapiSpec) eventBus(msg asyncapiMessage) (string, error) {
+	for _, owner := range []map[string]any{msg.message, msg.channel} {
+		b, err := s.binding(owner)
+		if err != nil {
+			return "", err
+		}
+		if bus, ok := b["eventBus"].(string); ok {
+			return bus, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *asyncapiSpec) binding(owner map[string]any) (map[string]any, error) {
+	v, err := s.deref(owner["bindings"])
+	if err != nil {
+		return nil, err
+	}
+	bindings, _ := v.(map[string]any)
+	if v, err = s.deref(bindings[asyncapiBinding]); err != nil {
+		return nil, err
+	}
+	b, _ := v.(map[string]any)
+	return b, nil
+}
+
+// payloadSchema returns the JSON schema of the message payload, unwrapping 3.x multi format schemas.
+func (s *asyncapiSpec) payloadSchema(msg asyncapiMessage) (any, error) {
+	payload, err := s.deref(msg.message["payload"])
+	if err != nil {
+		return nil, err
+	}
+
+	format, _ := msg.message["schemaFormat"].(string)
+	if m, ok := payload.(map[string]any); ok && s.version == 3 {
+		if f, ok := m["schemaFormat"].(string); ok {
+			format, payload = f, m["schema"]
+		}
+	}
+	if format != "" && !strings.Contains(format, "json") && !strings.Contains(format, "aai") && !strings.Contains(format, "asyncapi") {
+		return nil, fmt.Errorf("message %s schemaFormat %s is not supported, expected a JSON schema", msg.names[0], format)
+	}
+	return payload, nil
+}
+
+// example generates a value valid against schema: its const, examples, default or enum when
+// set, a value built from its type and constraints otherwise.
+func (s *asyncapiSpec) example(v any, depth int) (any, error) {
+	if depth > asyncapiMaxDepth {
+		return nil, fmt.Errorf("schema nested more than %d levels, or recursive", asyncapiMaxDepth)
+	}
+	v, err := s.deref(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// true and empty schemas accept anything
+	schema, ok := v.(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	if c, ok := schema["const"]; ok {
+		return c, nil
+	}
+	if examples, ok := schema["examples"].([]any); ok && len(examples) > 0 {
+		return examples[0], nil
+	}
+	for _, key := range []string{"example", "default"} {
+		if e, ok := schema[key]; ok {
+			return e, nil
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0], nil
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if l, ok := schema[key].([]any); ok && len(l) > 0 {
+			return s.example(l[0], depth+1)
+		}
+	}
+
+	var value any
+	switch schemaType(schema) {
+	case "object":
+		obj := map[string]any{}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, p := range properties {
+			if obj[name], err = s.example(p, depth+1); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		value = obj
+
+	case "array":
+		n := 1
+		if minItems, ok := schemaNumber(schema["minItems"]); ok && minItems > 1 {
+			n = int(minItems)
+		}
+		item, err := s.example(schema["items"], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		l := make([]any, n)
+		for i := range l {
+			l[i] = item
+		}
+		value = l
+
+	case "string":
+		value = exampleString(schema)
+	case "integer":
+		value = int(math.Ceil(exampleNumber(schema, 1)))
+	case "number":
+		value = exampleNumber(schema, 0.5)
+	case "boolean":
+		value = true
+	}
+
+	// the object schemas of allOf are merged
+	allOf, _ := schema["allOf"].([]any)
+	for _, sub := range allOf {
+		e, err := s.example(sub, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		switch x := e.(type) {
+		case map[string]any:
+			obj, _ := value.(map[string]any)
+			if obj == nil {
+				obj = map[string]any{}
+			}
+			maps.Copy(obj, x)
+			value = obj
+		default:
+			if value == nil {
+				value = x
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// deref follows local $ref, ie. '#/components/schemas/Order'.
+func (s *asyncapiSpec) deref(v any) (any, error) {
+	for range asyncapiMaxDepth {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return v, nil
+		}
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return v, nil
+		}
+		if !strings.HasPrefix(ref, "#/") {
+			return nil, fmt.Errorf("$ref %s can't be resolved, only references within %s are supported", ref, s.file)
+		}
+
+		keys := strings.Split(strings.TrimPrefix(ref, "#/"), "/")
+		for i, k := range keys {
+			keys[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(k)
+		}
+		if v, ok = lookupKeys(s.root, keys); !ok {
+			return nil, fmt.Errorf("$ref %s not found in %s", ref, s.file)
+		}
+	}
+	return nil, fmt.Errorf("$ref chained more than %d times, or circular", asyncapiMaxDepth)
+}
+
+// schemaType returns the type of a schema, the first non null one of a list, or the one implied by its keywords.
+func schemaType(schema map[string]any) string {
+	switch t := schema["type"].(type) {
+	case string:
+		return t
+	case []any:
+		for _, e := range t {
+			if s, ok := e.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+
+	switch {
+	case schema["properties"] != nil:
+		return "object"
+	case schema["items"] != nil:
+		return "array"
+	}
+	return ""
+}
+
+// exampleString returns a string of the schema format, or of its length bounds.
+func exampleString(schema map[string]any) string {
+	// rendered by the input event templates
+	format, _ := schema["format"].(string)
+	switch format {
+	case "uuid":
+		return "{{uuid}}"
+	case "date-time":
+		return "{{now}}"
+	case "date":
+		return "2024-01-01"
+	case "time":
+		return "00:00:00Z"
+	case "email":
+		return "user@example.com"
+	case "hostname":
+		return "example.com"
+	case "uri", "url":
+		return "https://example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	}
+
+	s := "string"
+	if minLength, ok := schemaNumber(schema["minLength"]); ok && int(minLength) > len(s) {
+		s += strings.Repeat("x", int(minLength)-len(s))
+	}
+	if maxLength, ok := schemaNumber(schema["maxLength"]); ok && int(maxLength) < len(s) {
+		s = s[:max(int(maxLength), 0)]
+	}
+	return s
+}
+
+// exampleNumber returns the lowest bound of the schema range, 0 when unbounded, step above exclusive bounds.
+func exampleNumber(schema map[string]any, step float64) float64 {
+	n := 0.0
+	if minimum, ok := schemaNumber(schema["minimum"]); ok {
+		n = minimum
+	}
+	if exclusive, ok := schemaNumber(schema["exclusiveMinimum"]); ok {
+		n = exclusive + step
+	}
+	if maximum, ok := schemaNumber(schema["maximum"]); ok && n > maximum {
+		n = maximum
+	}
+	if exclusive, ok := schemaNumber(schema["exclusiveMaximum"]); ok && n >= exclusive {
+		n = exclusive - step
+	}
+	return n
+}
+
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,183 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dataFromAsyncAPI(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "2.x headers const and enum",
+			source:  "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/paid",
+			pattern: `{"source":["orders"],"detail-type":["order.paid","order.paid.v2"]}`,
+			bus:     "orders",
+		},
+		{
+			name:    "2.x message by name",
+			source:  "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/paid/order.paid",
+			pattern: `{"source":["orders"],"detail-type":["order.paid","order.paid.v2"]}`,
+			bus:     "orders",
+		},
+		{
+			name:    "2.x oneOf message bindings",
+			source:  "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/refunded/OrderRefunded",
+			pattern: `{"source":["orders"],"detail-type":["order.refunded"]}`,
+		},
+		{
+			name:   "2.x several messages",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/refunded",
+			err:    "channel orders/refunded has 2 messages, choose one of: OrderPartiallyRefunded, OrderRefunded",
+		},
+		{
+			name:   "message not found",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/refunded/OrderPaid",
+			err:    "channel orders/refunded has no message OrderPaid, choose one of: OrderPartiallyRefunded, OrderRefunded",
+		},
+		{
+			name:   "channel not found",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders",
+			err:    "channel orders not found in testdata/asyncapi/orders-v2.yaml, choose one of: orders/paid, orders/refunded",
+		},
+		{
+			name:    "3.x channel address and bindings",
+			source:  "asyncapi://testdata/asyncapi/orders-v3.yaml/orders/shipped/OrderShipped",
+			pattern: `{"source":["orders"],"detail-type":["order.shipped"]}`,
+			bus:     "orders",
+		},
+		{
+			name:    "3.x channel id and message bindings list",
+			source:  "asyncapi://testdata/asyncapi/orders-v3.yaml/orderShipped/OrderReturned",
+			pattern: `{"source":["orders"],"detail-type":["order.returned","order.exchanged"]}`,
+			bus:     "orders",
+		},
+		{
+			name:   "missing spec",
+			source: "asyncapi://testdata/asyncapi/nonexistent.yaml/orders/paid",
+			err:    "no template file found",
+		},
+		{
+			name:   "not an AsyncAPI document",
+			source: "asyncapi://testdata/serverless.yml/functions",
+			err:    "unsupported AsyncAPI version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := dataFromAsyncAPI(tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
+
+func Test_eventFromAsyncAPI(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		event  string
+		err    string
+	}{
+		{
+			name:   "2.x payload schema",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/paid",
+			event: `{"source":"orders","detail-type":"order.paid","detail":"{\"code\":\"stringxx\",\"createdAt\":\"{{now}}\",\"currency\":\"EUR\",` +
+				`\"customer\":{\"email\":\"user@example.com\"},\"express\":true,\"id\":\"{{uuid}}\",\"items\":[{\"sku\":\"SKU-1\"},{\"sku\":\"SKU-1\"}],` +
+				`\"quantity\":1,\"total\":0.5}"}`,
+		},
+		{
+			name:   "2.x allOf",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/refunded/OrderRefunded",
+			event: `{"source":"orders","detail-type":"order.refunded","detail":"{\"code\":\"stringxx\",\"createdAt\":\"{{now}}\",\"currency\":\"EUR\",` +
+				`\"customer\":{\"email\":\"user@example.com\"},\"express\":true,\"id\":\"{{uuid}}\",\"items\":[{\"sku\":\"SKU-1\"},{\"sku\":\"SKU-1\"}],` +
+				`\"quantity\":1,\"reason\":\"damaged\",\"total\":0.5}"}`,
+		},
+		{
+			name:   "3.x multi format schema",
+			source: "asyncapi://testdata/asyncapi/orders-v3.yaml/orders/shipped/OrderShipped",
+			event:  `{"source":"orders","detail-type":"order.shipped","detail":"{\"carrier\":\"ups\",\"id\":\"{{uuid}}\"}"}`,
+		},
+		{
+			name:   "payload not an object",
+			source: "asyncapi://testdata/asyncapi/orders-v2.yaml/orders/refunded/OrderPartiallyRefunded",
+			err:    "message OrderPartiallyRefunded payload is not an object",
+		},
+		{
+			name:   "unsupported schema format",
+			source: "asyncapi://testdata/asyncapi/orders-v3.yaml/orders/cancelled",
+			err:    "message OrderCancelled schemaFormat application/vnd.apache.avro;version=1.9.0 is not supported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := resolveInputEvent(tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.event, event)
+
+			// placeholders are rendered like any input event template
+			_, err = renderTemplate(event, nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_asyncapiExample(t *testing.T) {
+	spec := &asyncapiSpec{file: "spec.yaml", root: map[string]any{
+		"components": map[string]any{"schemas": map[string]any{
+			"Node": map[string]any{"type": "object", "properties": map[string]any{"next": map[string]any{"$ref": "#/components/schemas/Node"}}},
+			"a/b":  map[string]any{"type": "boolean"},
+		}},
+	}}
+
+	tests := []struct {
+		name   string
+		schema any
+		want   any
+		err    string
+	}{
+		{name: "integer exclusive minimum", schema: map[string]any{"type": "integer", "exclusiveMinimum": 5}, want: 6},
+		{name: "integer maximum", schema: map[string]any{"type": "integer", "maximum": -3}, want: -3},
+		{name: "number exclusive maximum", schema: map[string]any{"type": "number", "exclusiveMaximum": 0}, want: -0.5},
+		{name: "string max length", schema: map[string]any{"type": "string", "maxLength": 3}, want: "str"},
+		{name: "nullable type", schema: map[string]any{"type": []any{"null", "boolean"}}, want: true},
+		{name: "anyOf", schema: map[string]any{"anyOf": []any{map[string]any{"type": "string", "format": "date"}}}, want: "2024-01-01"},
+		{name: "escaped reference", schema: map[string]any{"$ref": "#/components/schemas/a~1b"}, want: true},
+		{name: "empty schema", schema: map[string]any{}, want: nil},
+		{name: "recursive schema", schema: map[string]any{"$ref": "#/components/schemas/Node"}, err: "recursive"},
+		{name: "missing reference", schema: map[string]any{"$ref": "#/components/schemas/Order"}, err: "$ref #/components/schemas/Order not found in spec.yaml"},
+		{name: "external reference", schema: map[string]any{"$ref": "common.yaml#/Order"}, err: "only references within spec.yaml are supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spec.example(tt.schema, 0)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
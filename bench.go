@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v3"
+)
+
+// syntheticDetail is the detail of the events published by the bench and canary commands.
+type syntheticDetail struct {
+	Run    string `json:"run"`
+	Seq    int    `json:"seq"`
+	SentAt int64  `json:"sentAt"` // unix nanoseconds
+}
+
+// runBench publishes numbered events at --rate with --concurrency senders and measures
+// their end-to-end latency through the temporary rule and queue.
+func runBench(ctx context.Context, cmd *cli.Command, l *listener) error {
+	log.Printf("bench mode")
+
+	count, rate, concurrency := cmd.Int("count"), cmd.Int("rate"), max(cmd.Int("concurrency"), 1)
+	stats := newBenchStats(uuid.New().String())
+
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	defer cancelPoll()
+
+	signalChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	go l.sqs.poll(pollCtx, doneChan, pollOptions{
+		readyChan: readyChan,
+		quiet:     true,
+		workers:   cmd.Int("workers"),
+		onMessage: stats.receive,
+	})
+
+	// wait for poller to start before sending events
+	<-readyChan
+
+	// EventBridge does not guarantee that a newly created target is immediately active:
+	// send a probe event (sequence 0) every second until one is delivered, so the
+	// target activation isn't counted as lost events.
+	log.Printf("waiting for the rule target to activate...")
+	probe := time.NewTicker(time.Second)
+	activation := time.NewTimer(cmd.Duration("wait"))
+	defer probe.Stop()
+	defer activation.Stop()
+	for active := false; !active; {
+		if err := stats.sendProbe(ctx, l.eventbridge, cmd.String("source"), cmd.String("detail-type")); err != nil {
+			cancelPoll()
+			<-doneChan
+			return err
+		}
+
+		select {
+		case <-stats.probed:
+			active = true
+		case <-probe.C:
+		case <-activation.C:
+			cancelPoll()
+			<-doneChan
+			return fmt.Errorf("bench failed - no event delivered within %s, check the event pattern matches source %q", cmd.Duration("wait"), cmd.String("source"))
+		case <-doneChan:
+			return fmt.Errorf("bench failed - poller stopped: %w", l.sqs.err)
+		case <-signalChan:
+			cancelPoll()
+			<-doneChan
+			return nil
+		}
+	}
+
+	sendCtx, cancelSend := context.WithCancel(ctx)
+	defer cancelSend()
+	sentChan := make(chan struct{})
+	go func() {
+		defer close(sentChan)
+		stats.send(sendCtx, l.eventbridge, cmd.String("source"), cmd.String("detail-type"), count, rate, concurrency)
+	}()
+	log.Printf("sending %d events at %d/s with %d senders...", count, rate, concurrency)
+
+	var waitDone <-chan time.Time
+	for {
+		select {
+		case <-sentChan:
+			sentChan = nil
+			log.Printf("sent %d events, waiting up to %s for deliveries...", stats.sentCount(), cmd.Duration("wait"))
+			waitDone = time.After(cmd.Duration("wait"))
+			if stats.complete() {
+				waitDone = time.After(0)
+			}
+
+		case <-stats.progress:
+			if sentChan == nil && stats.complete() {
+				waitDone = time.After(0)
+			}
+
+		case <-waitDone:
+			cancelPoll()
+			<-doneChan
+			fmt.Print(stats.summary())
+			return nil
+
+		case <-doneChan:
+			return fmt.Errorf("bench failed - poller stopped: %w", l.sqs.err)
+
+		case <-signalChan:
+			log.Printf("received an interrupt, stopping...")
+			cancelSend()
+			if sentChan != nil {
+				<-sentChan
+			}
+			cancelPoll()
+			<-doneChan
+			fmt.Print(stats.summary())
+			return nil
+		}
+	}
+}
+
+// benchStats collects the sends and deliveries of one bench run.
+type benchStats struct {
+	run string
+
+	// progress is signalled, without blocking, on every delivery
+	progress chan struct{}
+	// probed is closed when the first probe event is delivered
+	probed    chan struct{}
+	probeOnce sync.Once
+
+	mu          sync.Mutex
+	sent        int
+	sendErrors  int
+	firstSend   time.Time
+	lastSend    time.Time
+	lastReceive time.Time
+	deliveries  map[int]int // seq -> deliveries
+	latencies   []time.Duration
+}
+
+func newBenchStats(run string) *benchStats {
+	return &benchStats{
+		run:        run,
+		progress:   make(chan struct{}, 1),
+		probed:     make(chan struct{}),
+		deliveries: map[int]int{},
+	}
+}
+
+// send publishes count events, at most rate per second (0 is unlimited), from concurrency
+// goroutines. It returns when every event is sent or ctx is done.
+func (s *benchStats) send(ctx context.Context, eb *eventbridgeClient, source, detailType string, count, rate, concurrency int) {
+	seqs := make(chan int)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := range seqs {
+				s.sendOne(ctx, eb, source, detailType, seq)
+			}
+		}()
+	}
+
+	// above one event per nanosecond the rate can't be paced, it is unlimited
+	var tick <-chan time.Time
+	if rate > 0 && rate <= int(time.Second) {
+		ticker := time.NewTicker(time.Second / time.Duration(rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+loop:
+	for seq := 1; seq <= count; seq++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break loop
+			}
+		}
+		select {
+		case seqs <- seq:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(seqs)
+	wg.Wait()
+}
+
+func (s *benchStats) sendProbe(ctx context.Context, eb *eventbridgeClient, source, detailType string) error {
+	_, err := eb.put(ctx, s.event(source, detailType, 0, time.Now()))
+	return err
+}
+
+func (s *benchStats) sendOne(ctx context.Context, eb *eventbridgeClient, source, detailType string, seq int) {
+	now := time.Now()
+	_, err := eb.put(ctx, s.event(source, detailType, seq, now))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("failed to send event %d: %v", seq, err)
+		}
+		s.sendErrors++
+		return
+	}
+	s.sent++
+	if s.firstSend.IsZero() || now.Before(s.firstSend) {
+		s.firstSend = now
+	}
+	if now.After(s.lastSend) {
+		s.lastSend = now
+	}
+}
+
+// event returns the input event for sequence number seq.
+func (s *benchStats) event(source, detailType string, seq int, sentAt time.Time) string {
+	return syntheticEvent(s.run, source, detailType, seq, sentAt)
+}
+
+// syntheticEvent returns an input event carrying the run id, its sequence number and send time.
+func syntheticEvent(run, source, detailType string, seq int, sentAt time.Time) string {
+	detail, _ := json.Marshal(syntheticDetail{Run: run, Seq: seq, SentAt: sentAt.UnixNano()})
+	event, _ := json.Marshal(inputEvent{Source: source, DetailType: detailType, Detail: string(detail)})
+	return string(event)
+}
+
+// parseSyntheticEvent returns the detail of a delivered synthetic event of run.
+func parseSyntheticEvent(run, body string) (syntheticDetail, bool) {
+	var ev struct {
+		Detail syntheticDetail `json:"detail"`
+	}
+	if err := json.Unmarshal([]byte(body), &ev); err != nil || ev.Detail.Run != run {
+		return syntheticDetail{}, false
+	}
+	return ev.Detail, true
+}
+
+// receive is the poller callback. Events from other runs, or not sent by bench, are ignored.
+func (s *benchStats) receive(body string) bool {
+	now := time.Now()
+
+	detail, ok := parseSyntheticEvent(s.run, body)
+	if !ok {
+		return false
+	}
+	if detail.Seq == 0 {
+		s.probeOnce.Do(func() { close(s.probed) })
+		return false
+	}
+
+	s.mu.Lock()
+	s.deliveries[detail.Seq]++
+	if s.deliveries[detail.Seq] == 1 {
+		s.latencies = append(s.latencies, now.Sub(time.Unix(0, detail.SentAt)))
+	}
+	s.lastReceive = now
+	s.mu.Unlock()
+
+	select {
+	case s.progress <- struct{}{}:
+	default:
+	}
+	return false
+}
+
+func (s *benchStats) sentCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sent
+}
+
+// complete reports whether every sent event was delivered.
+func (s *benchStats) complete() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.deliveries) >= s.sent
+}
+
+// summary renders throughput, latency percentiles, duplicates and losses.
+func (s *benchStats) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	received, duplicates := len(s.deliveries), 0
+	for _, n := range s.deliveries {
+		duplicates += n - 1
+	}
+	lost := max(s.sent-received, 0)
+
+	perSecond := func(n int, from, to time.Time) float64 {
+		d := to.Sub(from).Seconds()
+		if n == 0 || d <= 0 {
+			return 0
+		}
+		return float64(n) / d
+	}
+	lossRate := 0.0
+	if s.sent > 0 {
+		lossRate = float64(lost) / float64(s.sent) * 100
+	}
+
+	out := "bench results\n"
+	out += fmt.Sprintf("  sent       %d events in %s (%.1f/s), %d errors\n",
+		s.sent, s.lastSend.Sub(s.firstSend).Round(time.Millisecond), perSecond(s.sent, s.firstSend, s.lastSend), s.sendErrors)
+	out += fmt.Sprintf("  received   %d events (%.1f/s), %d duplicates\n",
+		received, perSecond(received, s.firstSend, s.lastReceive), duplicates)
+	out += fmt.Sprintf("  lost       %d (%.2f%%)\n", lost, lossRate)
+
+	if len(s.latencies) > 0 {
+		sorted := slices.Clone(s.latencies)
+		slices.Sort(sorted)
+		out += fmt.Sprintf("  latency    min %s  p50 %s  p95 %s  p99 %s  max %s\n",
+			sorted[0].Round(time.Millisecond),
+			percentile(sorted, 50).Round(time.Millisecond),
+			percentile(sorted, 95).Round(time.Millisecond),
+			percentile(sorted, 99).Round(time.Millisecond),
+			sorted[len(sorted)-1].Round(time.Millisecond))
+	}
+	return out
+}
+
+// percentile returns the nearest-rank percentile p of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
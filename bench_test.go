@@ -0,0 +1,119 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_percentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(d, 50))
+	assert.Equal(t, 95*time.Millisecond, percentile(d, 95))
+	assert.Equal(t, 99*time.Millisecond, percentile(d, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(d, 100))
+	assert.Equal(t, 1*time.Millisecond, percentile(d, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+// delivered wraps an input event as EventBridge delivers it.
+func delivered(t *testing.T, event string) string {
+	t.Helper()
+	body, err := deliveredEvent(event, "123456789012", "eu-north-1")
+	require.NoError(t, err)
+	return body
+}
+
+func Test_benchStats(t *testing.T) {
+	s := newBenchStats("run-1")
+	other := newBenchStats("run-2")
+	sentAt := time.Now().Add(-100 * time.Millisecond)
+
+	var in inputEvent
+	require.NoError(t, json.Unmarshal([]byte(s.event("eventbridge-cli.bench", "bench", 1, sentAt)), &in))
+	assert.Equal(t, "eventbridge-cli.bench", in.Source)
+	assert.Equal(t, "bench", in.DetailType)
+
+	// probe
+	assert.False(t, s.receive(delivered(t, s.event("src", "bench", 0, sentAt))))
+	select {
+	case <-s.probed:
+	default:
+		t.Fatal("probe not signalled")
+	}
+
+	s.sent = 3
+	s.firstSend, s.lastSend = sentAt, sentAt.Add(time.Second)
+	assert.False(t, s.receive(delivered(t, s.event("src", "bench", 1, sentAt))))
+	assert.False(t, s.receive(delivered(t, s.event("src", "bench", 1, sentAt))))
+	assert.False(t, s.receive(delivered(t, s.event("src", "bench", 2, sentAt))))
+	// ignored: other run and unrelated event
+	assert.False(t, s.receive(delivered(t, other.event("src", "bench", 3, sentAt))))
+	assert.False(t, s.receive(testEvent))
+
+	assert.False(t, s.complete())
+	assert.Len(t, s.latencies, 2)
+	assert.GreaterOrEqual(t, s.latencies[0], 100*time.Millisecond)
+
+	summary := s.summary()
+	assert.Contains(t, summary, "sent       3 events in 1s (3.0/s), 0 errors")
+	assert.Contains(t, summary, "received   2 events")
+	assert.Contains(t, summary, "1 duplicates")
+	assert.Contains(t, summary, "lost       1 (33.33%)")
+	assert.Contains(t, summary, "latency    min ")
+}
+
+func Test_benchStatsSendRate(t *testing.T) {
+	// a nanosecond ticker can't pace more than a billion events per second
+	assert.NotPanics(t, func() {
+		newBenchStats("run").send(context.Background(), nil, "bench", "bench", 0, 2_000_000_000, 1)
+	})
+}
+
+func Test_validateFlagsBench(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "defaults"},
+		{name: "unlimited rate", args: []string{"--rate", "0"}},
+		{name: "negative count", args: []string{"--count", "-1"}, err: "bench failed - --count can't be negative, got -1"},
+		{name: "negative rate", args: []string{"--rate", "-10"}, err: "bench failed - --rate can't be negative, got -10"},
+		{name: "negative concurrency", args: []string{"--concurrency", "-2"}, err: "bench failed - --concurrency can't be negative, got -2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			app := &cli.Command{
+				Name:  "bench",
+				Flags: flagsBench,
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					err = validateFlags(cmd)
+					return nil
+				},
+			}
+			require.NoError(t, app.Run(context.Background(), append([]string{"bench"}, tt.args...)))
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+			assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v3"
+)
+
+// metricsPrefix namespaces the exposed metrics.
+const metricsPrefix = "eventbridge_cli"
+
+// canaryBuckets are the latency histogram upper bounds, in seconds.
+var canaryBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// runCanary sends a synthetic event every --interval, waits for it through the temporary
+// rule and queue, and exposes the results on a Prometheus /metrics endpoint until interrupted.
+// ln is the metrics listener, bound before the temporary resources are created.
+func runCanary(ctx context.Context, cmd *cli.Command, l *listener, ln net.Listener) error {
+	log.Printf("canary mode")
+
+	c := newCanary(uuid.New().String(), l.eventbridge.eventBusName, time.Duration(cmd.Int64("timeout"))*time.Second, cmd.Duration("warmup"))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c.metrics)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("metrics server error: %v", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	log.Printf("serving metrics on http://%s/metrics", ln.Addr())
+
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	defer cancelPoll()
+
+	signalChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	opts := pollOptions{
+		readyChan: readyChan,
+		quiet:     true,
+		onMessage: c.receive,
+	}
+	go l.sqs.poll(pollCtx, doneChan, opts)
+
+	// wait for poller to start before sending events
+	<-readyChan
+	opts.readyChan = nil
+
+	source, detailType := cmd.String("source"), cmd.String("detail-type")
+	probe := func() {
+		now := time.Now()
+		seq := c.next(now)
+		if _, err := l.eventbridge.put(ctx, syntheticEvent(c.run, source, detailType, seq, now)); err != nil {
+			log.Printf("probe %d failed: %v", seq, err)
+			c.sendFailed(seq)
+		}
+	}
+
+	interval := time.NewTicker(cmd.Duration("interval"))
+	defer interval.Stop()
+	sweep := time.NewTicker(time.Second)
+	defer sweep.Stop()
+
+	// the poller gives up after --retry-max-attempts errors: restart it, with a backoff, so
+	// /metrics is still served and the probes not delivered meanwhile fail
+	var restart <-chan time.Time
+	restarts := 0
+
+	probe()
+	for {
+		select {
+		case <-interval.C:
+			probe()
+		case now := <-sweep.C:
+			c.expire(now)
+		case <-doneChan:
+			doneChan = nil
+			restarts++
+			c.metrics.pollerError()
+			delay := max(l.sqs.retry.backoff(restarts), time.Second)
+			log.Printf("poller stopped: %v, restarting in %s...", l.sqs.err, delay.Round(time.Millisecond))
+			l.sqs.err = nil
+			restart = time.After(delay)
+		case <-restart:
+			restart = nil
+			doneChan = make(chan struct{})
+			go l.sqs.poll(pollCtx, doneChan, opts)
+		case <-signalChan:
+			log.Printf("received an interrupt, stopping canary...")
+			cancelPoll()
+			if doneChan != nil {
+				<-doneChan
+			}
+			return nil
+		}
+	}
+}
+
+// canary tracks the probes in flight and records their outcome.
+type canary struct {
+	run     string
+	timeout time.Duration
+	warmup  time.Duration // failures before the first success within warmup aren't counted
+	start   time.Time
+	metrics *canaryMetrics
+
+	mu      sync.Mutex
+	seq     int
+	pending map[int]time.Time
+	ready   bool
+}
+
+func newCanary(run, bus string, timeout, warmup time.Duration) *canary {
+	return &canary{
+		run:     run,
+		timeout: timeout,
+		warmup:  warmup,
+		start:   time.Now(),
+		metrics: newCanaryMetrics(bus),
+		pending: map[int]time.Time{},
+	}
+}
+
+// next registers a new probe sent at now and returns its sequence number.
+func (c *canary) next(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	c.pending[c.seq] = now
+	return c.seq
+}
+
+func (c *canary) sendFailed(seq int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, seq)
+	c.metrics.fail("send_error")
+}
+
+// receive is the poller callback recording the round trip of delivered probes.
+func (c *canary) receive(body string) bool {
+	detail, ok := parseSyntheticEvent(c.run, body)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sentAt, ok := c.pending[detail.Seq]
+	if !ok {
+		// duplicate or already timed out
+		return false
+	}
+	delete(c.pending, detail.Seq)
+	c.ready = true
+
+	latency := time.Since(sentAt)
+	log.Printf("probe %d delivered in %s", detail.Seq, latency.Round(time.Millisecond))
+	c.metrics.observe(latency)
+	return false
+}
+
+// expire fails the probes pending for longer than the timeout.
+func (c *canary) expire(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for seq, sentAt := range c.pending {
+		if now.Sub(sentAt) < c.timeout {
+			continue
+		}
+		delete(c.pending, seq)
+
+		if !c.ready && now.Sub(c.start) < c.warmup {
+			log.Printf("probe %d not delivered within %s, the rule target may not be active yet", seq, c.timeout)
+			continue
+		}
+		log.Printf("probe %d not delivered within %s", seq, c.timeout)
+		c.metrics.fail("timeout")
+	}
+}
+
+// canaryMetrics are exposed in the Prometheus text format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+type canaryMetrics struct {
+	bus string
+
+	mu           sync.Mutex
+	success      uint64
+	failures     map[string]uint64 // by reason
+	pollerErrors uint64
+	buckets      []uint64 // cumulative counts per canaryBuckets bound
+	sum          float64
+	lastLatency  float64
+	lastSuccess  time.Time
+}
+
+func newCanaryMetrics(bus string) *canaryMetrics {
+	return &canaryMetrics{
+		bus:      bus,
+		failures: map[string]uint64{"send_error": 0, "timeout": 0},
+		buckets:  make([]uint64, len(canaryBuckets)),
+	}
+}
+
+func (m *canaryMetrics) observe(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := latency.Seconds()
+	m.success++
+	m.sum += s
+	m.lastLatency = s
+	m.lastSuccess = time.Now()
+	for i, le := range canaryBuckets {
+		if s <= le {
+			m.buckets[i]++
+		}
+	}
+}
+
+func (m *canaryMetrics) fail(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures[reason]++
+}
+
+// pollerError counts a poller stopped by errors, before it is restarted.
+func (m *canaryMetrics) pollerError() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pollerErrors++
+}
+
+func (m *canaryMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *canaryMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bus := `bus="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(m.bus) + `"`
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	fmt.Fprintf(w, "# HELP %s_canary_probes_total Canary probes by result.\n", metricsPrefix)
+	fmt.Fprintf(w, "# TYPE %s_canary_probes_total counter\n", metricsPrefix)
+	fmt.Fprintf(w, "%s_canary_probes_total{%s,result=\"success\"} %d\n", metricsPrefix, bus, m.success)
+	for _, reason := range []string{"send_error", "timeout"} {
+		fmt.Fprintf(w, "%s_canary_probes_total{%s,result=\"%s\"} %d\n", metricsPrefix, bus, reason, m.failures[reason])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_canary_poller_errors_total Times the queue poller stopped on errors and was restarted.\n", metricsPrefix)
+	fmt.Fprintf(w, "# TYPE %s_canary_poller_errors_total counter\n", metricsPrefix)
+	fmt.Fprintf(w, "%s_canary_poller_errors_total{%s} %d\n", metricsPrefix, bus, m.pollerErrors)
+
+	fmt.Fprintf(w, "# HELP %s_canary_latency_seconds Round-trip latency of delivered probes.\n", metricsPrefix)
+	fmt.Fprintf(w, "# TYPE %s_canary_latency_seconds histogram\n", metricsPrefix)
+	for i, le := range canaryBuckets {
+		fmt.Fprintf(w, "%s_canary_latency_seconds_bucket{%s,le=\"%s\"} %d\n", metricsPrefix, bus, float(le), m.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_canary_latency_seconds_bucket{%s,le=\"+Inf\"} %d\n", metricsPrefix, bus, m.success)
+	fmt.Fprintf(w, "%s_canary_latency_seconds_sum{%s} %s\n", metricsPrefix, bus, float(m.sum))
+	fmt.Fprintf(w, "%s_canary_latency_seconds_count{%s} %d\n", metricsPrefix, bus, m.success)
+
+	fmt.Fprintf(w, "# HELP %s_canary_last_latency_seconds Round-trip latency of the last delivered probe.\n", metricsPrefix)
+	fmt.Fprintf(w, "# TYPE %s_canary_last_latency_seconds gauge\n", metricsPrefix)
+	fmt.Fprintf(w, "%s_canary_last_latency_seconds{%s} %s\n", metricsPrefix, bus, float(m.lastLatency))
+
+	fmt.Fprintf(w, "# HELP %s_canary_last_success_timestamp_seconds Unix time of the last delivered probe.\n", metricsPrefix)
+	fmt.Fprintf(w, "# TYPE %s_canary_last_success_timestamp_seconds gauge\n", metricsPrefix)
+	lastSuccess := 0.0
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = float64(m.lastSuccess.UnixMilli()) / 1000
+	}
+	fmt.Fprintf(w, "%s_canary_last_success_timestamp_seconds{%s} %s\n", metricsPrefix, bus, float(lastSuccess))
+}
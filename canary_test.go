@@ -0,0 +1,128 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_canary(t *testing.T) {
+	c := newCanary("run-1", "default", 10*time.Second, time.Minute)
+	now := time.Now()
+
+	// delivered probe
+	seq := c.next(now.Add(-300 * time.Millisecond))
+	assert.False(t, c.receive(delivered(t, syntheticEvent("run-1", "src", "canary", seq, now))))
+	assert.Equal(t, uint64(1), c.metrics.success)
+	assert.InDelta(t, 0.3, c.metrics.lastLatency, 0.2)
+
+	// duplicate and other runs are ignored
+	assert.False(t, c.receive(delivered(t, syntheticEvent("run-1", "src", "canary", seq, now))))
+	assert.False(t, c.receive(delivered(t, syntheticEvent("run-2", "src", "canary", 2, now))))
+	assert.Equal(t, uint64(1), c.metrics.success)
+
+	// timed out probe
+	c.next(now)
+	c.expire(now.Add(5 * time.Second))
+	assert.Len(t, c.pending, 1)
+	c.expire(now.Add(11 * time.Second))
+	assert.Empty(t, c.pending)
+	assert.Equal(t, uint64(1), c.metrics.failures["timeout"])
+
+	// failed send
+	c.sendFailed(c.next(now))
+	assert.Equal(t, uint64(1), c.metrics.failures["send_error"])
+}
+
+func Test_canaryWarmup(t *testing.T) {
+	c := newCanary("run-1", "default", time.Second, time.Minute)
+	now := time.Now()
+
+	// target not active yet
+	c.next(now)
+	c.expire(now.Add(2 * time.Second))
+	assert.Equal(t, uint64(0), c.metrics.failures["timeout"])
+
+	// warmup elapsed
+	c.next(now)
+	c.expire(now.Add(2 * time.Minute))
+	assert.Equal(t, uint64(1), c.metrics.failures["timeout"])
+}
+
+func Test_canaryMetrics(t *testing.T) {
+	m := newCanaryMetrics(`my "bus"`)
+	m.observe(200 * time.Millisecond)
+	m.observe(3 * time.Second)
+	m.fail("timeout")
+	m.pollerError()
+
+	var buf bytes.Buffer
+	m.write(&buf)
+	out := buf.String()
+
+	assert.Contains(t, out, "# TYPE eventbridge_cli_canary_probes_total counter\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_probes_total{bus="my \"bus\"",result="success"} 2`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_probes_total{bus="my \"bus\"",result="timeout"} 1`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_probes_total{bus="my \"bus\"",result="send_error"} 0`+"\n")
+	assert.Contains(t, out, "# TYPE eventbridge_cli_canary_poller_errors_total counter\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_poller_errors_total{bus="my \"bus\""} 1`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_latency_seconds_bucket{bus="my \"bus\"",le="0.1"} 0`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_latency_seconds_bucket{bus="my \"bus\"",le="0.25"} 1`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_latency_seconds_bucket{bus="my \"bus\"",le="5"} 2`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_latency_seconds_bucket{bus="my \"bus\"",le="+Inf"} 2`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_latency_seconds_sum{bus="my \"bus\""} 3.2`+"\n")
+	assert.Contains(t, out, `eventbridge_cli_canary_last_latency_seconds{bus="my \"bus\""} 3`+"\n")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "eventbridge_cli_canary_latency_seconds_count")
+}
+
+func Test_validateFlagsCanary(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "defaults"},
+		// seconds, like the ci and wait timeouts shared by presets
+		{name: "timeout", args: []string{"--timeout", "30"}},
+		{name: "no warmup", args: []string{"--warmup", "0s"}},
+		{name: "zero interval", args: []string{"--interval", "0s"}, err: "--interval must be positive, got 0s"},
+		{name: "negative interval", args: []string{"--interval", "-1m"}, err: "--interval must be positive, got -1m0s"},
+		{name: "zero timeout", args: []string{"--timeout", "0"}, err: "--timeout must be positive, got 0"},
+		{name: "negative warmup", args: []string{"--warmup", "-1s"}, err: "--warmup can't be negative, got -1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			app := &cli.Command{
+				Name:  "canary",
+				Flags: flagsCanary,
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					err = validateFlags(cmd)
+					return nil
+				},
+			}
+			require.NoError(t, app.Run(context.Background(), append([]string{"canary"}, tt.args...)))
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+			assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+		})
+	}
+}
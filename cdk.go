@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// cdkManifest is the subset of a cloud assembly manifest.json read by the 'cdk://' source.
+// https://github.com/aws/aws-cdk/tree/main/packages/%40aws-cdk/cloud-assembly-schema
+type cdkManifest struct {
+	Artifacts map[string]struct {
+		Type        string `json:"type"`
+		DisplayName string `json:"displayName"`
+		Properties  struct {
+			TemplateFile  string `json:"templateFile"`
+			DirectoryName string `json:"directoryName"`
+		} `json:"properties"`
+	} `json:"artifacts"`
+}
+
+// cdkStack is a stack synthesized in a cloud assembly.
+type cdkStack struct {
+	path     string // construct path, ie. 'OrdersStack' or 'Prod/OrdersStack' within a stage
+	template string
+}
+
+// cdk://cdk.out/StackName/ConstructPath
+func dataFromCDK(ctx context.Context, src *dataSources, cdkpath string) (string, string, error) {
+	assembly, rest, err := splitAssemblyPath(strings.TrimPrefix(cdkpath, "cdk://"))
+	if err != nil {
+		return "", "", err
+	}
+
+	stacks, err := cdkStacks(assembly)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the longest stack path prefix, stages nest stacks as 'Stage/Stack'
+	var stack *cdkStack
+	for i, s := range stacks {
+		if strings.HasPrefix(rest, s.path+"/") && (stack == nil || len(s.path) > len(stack.path)) {
+			stack = &stacks[i]
+		}
+	}
+	if stack == nil {
+		names := make([]string, 0, len(stacks))
+		for _, s := range stacks {
+			names = append(names, s.path)
+		}
+		slices.Sort(names)
+		return "", "", fmt.Errorf("no stack found for %s in %s, choose one of: %s", rest, assembly, strings.Join(names, ", "))
+	}
+	constructPath := strings.TrimPrefix(rest, stack.path+"/")
+
+	t, err := loadTemplate(stack.template)
+	if err != nil {
+		return "", "", err
+	}
+
+	// L2 constructs wrap the CloudFormation resource in a 'Resource' child
+	var choices []string
+	for logicalID, res := range t.Resources {
+		p := strings.TrimPrefix(res.Metadata.CDKPath, stack.path+"/")
+		if p == constructPath || p == constructPath+"/Resource" {
+			return newCFNResolver(ctx, src, t).resourcePattern(logicalID, "")
+		}
+		if res.Type == "AWS::Events::Rule" || res.Type == "AWS::Pipes::Pipe" {
+			choices = append(choices, strings.TrimSuffix(p, "/Resource"))
+		}
+	}
+	slices.Sort(choices)
+
+	if len(choices) == 0 {
+		return "", "", fmt.Errorf("construct %s not found in stack %s, synthesize with path metadata enabled", constructPath, stack.path)
+	}
+	return "", "", fmt.Errorf("construct %s not found in stack %s, choose one of: %s", constructPath, stack.path, strings.Join(choices, ", "))
+}
+
+// splitAssemblyPath splits a source path into the cloud assembly directory, the one holding
+// manifest.json, and the stack and construct path within it.
+func splitAssemblyPath(p string) (string, string, error) {
+	parts := strings.Split(p, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		dir := strings.Join(parts[:i], "/")
+		if fi, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil && fi.Mode().IsRegular() {
+			return dir, strings.Join(parts[i:], "/"), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("no cloud assembly manifest.json found in %s", p)
+}
+
+// cdkStacks lists the stacks of a cloud assembly, including the nested assemblies of stages.
+func cdkStacks(dir string) ([]cdkStack, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &cdkManifest{}
+	if err := json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("invalid cloud assembly manifest %s: %w", dir, err)
+	}
+
+	var stacks []cdkStack
+	for id, a := range m.Artifacts {
+		switch a.Type {
+		case "aws:cloudformation:stack":
+			path := a.DisplayName
+			if path == "" {
+				path = id
+			}
+			stacks = append(stacks, cdkStack{path: path, template: filepath.Join(dir, a.Properties.TemplateFile)})
+
+		case "cdk:cloud-assembly":
+			nested, err := cdkStacks(filepath.Join(dir, a.Properties.DirectoryName))
+			if err != nil {
+				return nil, err
+			}
+			stacks = append(stacks, nested...)
+		}
+	}
+
+	return stacks, nil
+}
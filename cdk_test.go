@@ -0,0 +1,72 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dataFromCDK(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "rule by construct path",
+			source:  "cdk://testdata/cdk.out/OrdersStack/OrdersPaidRule",
+			pattern: `{"source":["orders"],"detail-type":["order.paid"]}`,
+			bus:     "orders-eventbus",
+		},
+		{
+			name:    "rule by resource path",
+			source:  "cdk://testdata/cdk.out/OrdersStack/OrdersPaidRule/Resource",
+			pattern: `{"source":["orders"],"detail-type":["order.paid"]}`,
+			bus:     "orders-eventbus",
+		},
+		{
+			name:    "stack of a stage",
+			source:  "cdk://testdata/cdk.out/Prod/OrdersStack/OrdersPaidRule",
+			pattern: `{"source":["eu-north-1.orders"],"detail-type":["order.paid"]}`,
+		},
+		{
+			name:   "schedule rule",
+			source: "cdk://testdata/cdk.out/OrdersStack/Nightly/Rule",
+			err:    "has no event pattern",
+		},
+		{
+			name:   "missing construct lists the rules",
+			source: "cdk://testdata/cdk.out/OrdersStack/OrdersRefundedRule",
+			err:    "construct OrdersRefundedRule not found in stack OrdersStack, choose one of: Nightly/Rule, OrdersPaidRule",
+		},
+		{
+			name:   "missing stack",
+			source: "cdk://testdata/cdk.out/PaymentsStack/PaidRule",
+			err:    "no stack found for PaymentsStack/PaidRule in testdata/cdk.out, choose one of: OrdersStack, Prod/OrdersStack",
+		},
+		{
+			name:   "missing assembly",
+			source: "cdk://testdata/OrdersStack/OrdersPaidRule",
+			err:    "no cloud assembly manifest.json found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := resolveEventPattern(context.Background(), &dataSources{region: "eu-north-1"}, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
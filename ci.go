@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/urfave/cli/v3"
+)
+
+// ciInput is what CI mode sends and checks the deliveries against.
+type ciInput struct {
+	events     []string
+	assertions []eventPattern
+	steps      []eventPattern
+}
+
+// readCIInput reads the input events, rendering their templates, the assertions and the expected
+// steps. It fails fast, before the temporary resources are created, when the input can never match.
+func readCIInput(ctx context.Context, cmd *cli.Command, src *dataSources, eb *eventbridgeClient, eventPattern string, report *ciReport) (*ciInput, error) {
+	in := &ciInput{}
+	trigger := cmd.String("trigger")
+	if trigger == "" {
+		input, err := inputEventFromFlags(cmd)
+		if err != nil {
+			return nil, ciFailure(exitInvalidInput, err)
+		}
+		if in.events, err = parseInputEvents(input); err != nil {
+			return nil, ciFailure(exitInvalidInput, err)
+		}
+	}
+	for _, event := range in.events {
+		report.InputEvents = append(report.InputEvents, rawJSON(event))
+	}
+	report.Trigger = trigger
+
+	var err error
+	if in.assertions, err = parseAssertions(cmd.StringSlice("assert")); err != nil {
+		return nil, ciFailure(exitInvalidInput, err)
+	}
+	if in.steps, err = parseAssertions(cmd.StringSlice("expect")); err != nil {
+		return nil, ciFailure(exitInvalidInput, err)
+	}
+
+	// With --expect the input events start a flow and don't have to match the rule.
+	if len(in.steps) > 0 || len(in.events) == 0 {
+		return in, nil
+	}
+	account, err := src.accountID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CI failed - %w", err)
+	}
+	for _, event := range in.events {
+		err := eb.checkInput(ctx, event, eventPattern, account, src.region)
+		var apiErr smithy.APIError
+		switch {
+		case err == nil:
+		case errors.Is(err, errPatternMismatch):
+			return nil, ciFailure(exitPatternMismatch, err)
+		case errors.As(err, &apiErr):
+			return nil, fmt.Errorf("CI failed - %w", err)
+		default:
+			return nil, ciFailure(exitInvalidInput, err)
+		}
+	}
+	return in, nil
+}
+
+// runCI sends the input events, or runs the trigger command, and succeeds once the expected
+// events, satisfying the assertions, are delivered through the temporary rule.
+func runCI(ctx context.Context, cmd *cli.Command, l *listener, in *ciInput, report *ciReport) error {
+	log.Printf("CI mode")
+
+	report.EventPattern = l.eventPattern
+	report.RuleArn = l.ruleArn
+	report.Timings.RuleCreation = l.ruleCreation.Milliseconds()
+
+	trigger, events := cmd.String("trigger"), in.events
+
+	timeout := time.Duration(cmd.Int64("timeout")) * time.Second
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	defer cancelPoll()
+
+	d := newCIDeliveries(in.assertions, in.steps, cmd.Bool("unordered"))
+	d.inputs = len(events)
+	sentAt := map[string]time.Time{}
+	var firstSent time.Time
+	defer func() { d.record(report, l.linkedAt, sentAt, firstSent) }()
+	signalChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	go l.sqs.poll(pollCtx, doneChan, pollOptions{
+		readyChan:  readyChan,
+		prettyJSON: cmd.Bool("prettyjson"),
+		prefix:     "received event: ",
+		// ordered sequences are checked by SQS sent timestamp rather than receive order
+		ordered:   len(in.steps) > 1 && !d.unordered,
+		onMessage: d.onMessage,
+	})
+
+	// wait for poller to start before sending the events
+	<-readyChan
+
+	stop := func(err error) error {
+		cancelPoll()
+		<-doneChan
+		return err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	sends, maxSends := 0, cmd.Int("max-sends")
+	if cmd.Bool("no-resend") {
+		maxSends = 1
+	}
+	send := func() error {
+		sends++
+		report.Sends = sends
+		for _, event := range events {
+			now := time.Now()
+			id, err := l.eventbridge.putEvent(ctx, event)
+			if err != nil {
+				return err
+			}
+			sentAt[id] = now
+			if firstSent.IsZero() {
+				firstSent = now
+			}
+		}
+		return nil
+	}
+
+	var resend <-chan time.Time
+	var triggerChan <-chan triggerResult
+	if trigger != "" {
+		triggerCtx, cancelTrigger := context.WithTimeout(ctx, timeout)
+		defer cancelTrigger()
+		firstSent = time.Now()
+		triggerChan = runTrigger(triggerCtx, trigger)
+	} else {
+		// EventBridge does not guarantee that a newly created target is immediately active.
+		// Send the events once, then re-send on a short interval (bounded by --timeout and
+		// --max-sends) so we proceed as soon as the target is ready.
+		// https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-troubleshooting.html#eb-rule-does-not-match
+		if err := send(); err != nil {
+			return stop(err)
+		}
+
+		if maxSends != 1 {
+			ticker := time.NewTicker(cmd.Duration("resend-interval"))
+			defer ticker.Stop()
+			resend = ticker.C
+		}
+	}
+
+	received, complete := d.receivedChan, d.completeChan
+	var drained <-chan time.Time
+	for {
+		select {
+		case <-received:
+			received, resend = nil, nil
+
+		case <-complete:
+			complete, resend = nil, nil
+			deadline.Stop()
+
+			drain := cmd.Duration("drain")
+			if drain <= 0 {
+				return d.finish(stop(nil), triggerChan, sends, cmd.Int("expect-count"))
+			}
+			log.Printf("expected events received, draining the queue for %s...", drain)
+			drained = time.After(drain)
+
+		case <-drained:
+			return d.finish(stop(nil), triggerChan, sends, cmd.Int("expect-count"))
+
+		case <-doneChan:
+			if l.sqs.err != nil {
+				return fmt.Errorf("CI failed - poller stopped: %w", l.sqs.err)
+			}
+			return d.err
+
+		case <-deadline.C:
+			return stop(d.timeoutError(timeout))
+
+		case res := <-triggerChan:
+			triggerChan = nil
+			if err := res.check(); err != nil {
+				return stop(fmt.Errorf("CI failed - %w", err))
+			}
+
+		case <-signalChan:
+			report.Status = "interrupted"
+			return stop(nil)
+
+		case <-resend:
+			if maxSends > 0 && sends >= maxSends {
+				log.Printf("sent %d times, no more retries", sends)
+				resend = nil
+				continue
+			}
+			log.Printf("no event received yet, retrying...")
+			if err := send(); err != nil {
+				return stop(err)
+			}
+		}
+	}
+}
+
+// ciDeliveries accounts for the events delivered while CI mode polls. Every event must
+// satisfy the assertions, then the expected steps in order (or in any order if unordered).
+// Without steps the first event satisfying the assertions completes the run.
+type ciDeliveries struct {
+	assertions []eventPattern
+	steps      []eventPattern
+	unordered  bool
+	inputs     int // input events sent, each expected once
+
+	receivedChan chan struct{} // closed on the first expected event
+	completeChan chan struct{} // closed once every step is satisfied
+
+	mu        sync.Mutex
+	events    []string // expected events, duplicates included
+	firstAt   time.Time
+	firstID   string
+	satisfied []bool
+	next      int // number of satisfied steps
+	ids       map[string]int
+	mismatch  string // why the last rejected event was rejected
+	rejected  string
+	err       error
+}
+
+func newCIDeliveries(assertions, steps []eventPattern, unordered bool) *ciDeliveries {
+	return &ciDeliveries{
+		assertions:   assertions,
+		steps:        steps,
+		unordered:    unordered,
+		receivedChan: make(chan struct{}),
+		completeChan: make(chan struct{}),
+		satisfied:    make([]bool, len(steps)),
+		ids:          map[string]int{},
+	}
+}
+
+// onMessage is called by the poller for every delivered event. It only stops the poller
+// on an invalid pattern or an out of order step, so duplicates can be counted while draining.
+func (d *ciDeliveries) onMessage(body string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reason, err := checkAssertions(d.assertions, body)
+	switch {
+	case err != nil:
+		d.err = ciFailure(exitInvalidInput, fmt.Errorf("invalid assertion: %w", err))
+		return true
+	case reason != "":
+		log.Printf("event does not satisfy assertions: %s", reason)
+		d.mismatch, d.rejected = reason, body
+		return false
+	}
+
+	complete := len(d.steps) == 0 && len(d.events) == 0
+	if len(d.steps) > 0 {
+		step, reason, err := d.matchStep(body)
+		switch {
+		case err != nil:
+			d.err = ciFailure(exitInvalidInput, fmt.Errorf("invalid expectation: %w", err))
+			return true
+		case step < 0:
+			log.Printf("event does not match any expected event: %s", reason)
+			d.mismatch, d.rejected = reason, body
+			return false
+		case d.satisfied[step]:
+			log.Printf("received step %d again", step+1)
+		case !d.unordered && step != d.next:
+			d.err = ciFailure(exitAssertionFailure, fmt.Errorf("step %d received before step %d", step+1, d.next+1))
+			return true
+		default:
+			d.satisfied[step] = true
+			d.next++
+			log.Printf("step %d satisfied (%d/%d)", step+1, d.next, len(d.steps))
+			complete = d.next == len(d.steps)
+		}
+	}
+
+	var ev struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal([]byte(body), &ev)
+	d.ids[ev.ID]++
+
+	d.events = append(d.events, body)
+	if len(d.events) == 1 {
+		d.firstAt, d.firstID = time.Now(), ev.ID
+		close(d.receivedChan)
+	}
+	if complete {
+		close(d.completeChan)
+	}
+	return false
+}
+
+// matchStep returns the step event matches, preferring pending steps, or -1 and
+// why the first pending step rejects it.
+func (d *ciDeliveries) matchStep(event string) (int, string, error) {
+	reason := ""
+	for _, pending := range []bool{true, false} {
+		for i, step := range d.steps {
+			if d.satisfied[i] == pending {
+				continue
+			}
+			ok, r, err := step.match(event)
+			if err != nil {
+				return -1, "", fmt.Errorf("step %d: %w", i+1, err)
+			}
+			if ok {
+				return i, "", nil
+			}
+			if reason == "" && pending {
+				reason = fmt.Sprintf("step %d: %s", i+1, r)
+			}
+		}
+	}
+	return -1, reason, nil
+}
+
+func (d *ciDeliveries) timeoutError(timeout time.Duration) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// events were delivered but rejected: a test failure rather than a timeout
+	code := exitTimeout
+	var msg string
+	switch {
+	case d.next > 0:
+		msg = fmt.Sprintf("received %d of %d expected events within %s", d.next, len(d.steps), timeout)
+	case d.mismatch != "" && len(d.steps) > 0:
+		code, msg = exitAssertionFailure, fmt.Sprintf("no expected event received within %s", timeout)
+	case d.mismatch != "":
+		code, msg = exitAssertionFailure, fmt.Sprintf("no event satisfied the assertions within %s", timeout)
+	default:
+		msg = fmt.Sprintf("didn't receive any event within %s", timeout)
+	}
+	if d.mismatch != "" {
+		msg += ": " + d.mismatch
+	}
+	return ciFailure(code, errors.New(msg))
+}
+
+// finish waits for the trigger, if still running, reports duplicates and checks the
+// delivered count. It must be called once the poller stopped.
+func (d *ciDeliveries) finish(err error, triggerChan <-chan triggerResult, sends, expectCount int) error {
+	if err != nil {
+		return err
+	}
+
+	// the events can be delivered while the trigger is still running
+	if triggerChan != nil {
+		if err := (<-triggerChan).check(); err != nil {
+			return fmt.Errorf("CI failed - %w", err)
+		}
+	}
+
+	received, duplicates, redelivered := d.counts()
+	if sends > 0 {
+		log.Printf("sent %d times, received %d events (%d duplicates, %d redelivered)", sends, received, duplicates, redelivered)
+	} else {
+		log.Printf("received %d events (%d duplicates, %d redelivered)", received, duplicates, redelivered)
+	}
+
+	if expectCount > 0 && received != expectCount {
+		return ciFailure(exitAssertionFailure, fmt.Errorf("expected %d events, received %d", expectCount, received))
+	}
+
+	log.Printf("CI successful - message received")
+	return nil
+}
+
+// counts returns the expected events received, duplicates included, how many of them are
+// duplicates and how many were delivered more than once with the same event id.
+// Re-sent copies of an input event have their own id, so duplicates are the events beyond one per
+// input event or step. A trigger emits an unknown number of distinct events, only an already seen
+// event id is a duplicate.
+func (d *ciDeliveries) counts() (received, duplicates, redelivered int) {
+	received = len(d.events)
+	if received == 0 {
+		return 0, 0, 0
+	}
+	redelivered = received - len(d.ids)
+	switch {
+	case len(d.steps) > 0:
+		duplicates = max(received-len(d.steps), 0)
+	case d.inputs > 0:
+		duplicates = max(received-d.inputs, 0)
+	default:
+		duplicates = redelivered
+	}
+	return received, duplicates, redelivered
+}
+
+// record copies the deliveries and timings into the report. The first delivery latency is
+// measured from the send that produced it when its id is known, from the first send otherwise.
+func (d *ciDeliveries) record(r *ciReport, linkedAt time.Time, sentAt map[string]time.Time, firstSent time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, event := range d.events {
+		r.Events = append(r.Events, rawJSON(event))
+	}
+	_, r.Duplicates, r.Redelivered = d.counts()
+	if d.rejected != "" {
+		r.LastRejected = &ciRejection{Event: rawJSON(d.rejected), Reason: d.mismatch, Diff: d.diff(d.rejected)}
+	}
+
+	if d.firstAt.IsZero() {
+		return
+	}
+	r.Timings.TargetActivation = d.firstAt.Sub(linkedAt).Milliseconds()
+	if sent, ok := sentAt[d.firstID]; ok {
+		firstSent = sent
+	}
+	if !firstSent.IsZero() {
+		r.Timings.FirstDelivery = d.firstAt.Sub(firstSent).Milliseconds()
+	}
+}
+
+// diff compares event with the first assertion, or pending step, it doesn't match.
+func (d *ciDeliveries) diff(event string) []string {
+	for _, a := range d.assertions {
+		if lines, err := a.diff(event); err == nil && len(lines) > 0 {
+			return lines
+		}
+	}
+	for i, step := range d.steps {
+		if d.satisfied[i] {
+			continue
+		}
+		if lines, err := step.diff(event); err == nil && len(lines) > 0 {
+			return lines
+		}
+	}
+	return nil
+}
+
+// ciFailure fails the CI run with an exit code telling test failures from infrastructure ones.
+func ciFailure(code int, err error) error {
+	return &exitError{code: code, err: fmt.Errorf("CI failed - %w", err)}
+}
+
+// parseAssertions reads event patterns, inline or from 'file://', that received events must match.
+func parseAssertions(values []string) ([]eventPattern, error) {
+	assertions := make([]eventPattern, 0, len(values))
+	for _, v := range values {
+		if strings.HasPrefix(v, "file://") {
+			var err error
+			if v, err = dataFromFile(v); err != nil {
+				return nil, err
+			}
+		}
+
+		p, err := parseEventPattern(v)
+		if err != nil {
+			return nil, fmt.Errorf("assertion: %w", err)
+		}
+		assertions = append(assertions, p)
+	}
+	return assertions, nil
+}
+
+// checkAssertions returns why the first failing assertion rejects event, or "" if all pass.
+func checkAssertions(assertions []eventPattern, event string) (string, error) {
+	for _, a := range assertions {
+		ok, reason, err := a.match(event)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return reason, nil
+		}
+	}
+	return "", nil
+}
+
+// triggerResult is the outcome of the --trigger command.
+type triggerResult struct {
+	command  string
+	stdout   string
+	stderr   string
+	exitCode int
+	duration time.Duration
+	err      error
+}
+
+func (r triggerResult) check() error {
+	if r.err != nil {
+		return fmt.Errorf("trigger %q exited with code %d: %w", r.command, r.exitCode, r.err)
+	}
+	return nil
+}
+
+// runTrigger runs command through the shell, capturing its output and exit code.
+func runTrigger(ctx context.Context, command string) <-chan triggerResult {
+	resChan := make(chan triggerResult, 1)
+	go func() {
+		log.Printf("running trigger: %s", command)
+
+		var stdout, stderr bytes.Buffer
+		c := shellCommand(ctx, command)
+		c.Stdout, c.Stderr = &stdout, &stderr
+
+		start := time.Now()
+		err := c.Run()
+		res := triggerResult{
+			command:  command,
+			stdout:   stdout.String(),
+			stderr:   stderr.String(),
+			exitCode: exitCode(err),
+			duration: time.Since(start),
+			err:      err,
+		}
+
+		log.Printf("trigger exited with code %d in %s", res.exitCode, res.duration.Round(time.Millisecond))
+		if res.stdout != "" {
+			log.Printf("trigger stdout: %s", strings.TrimSpace(res.stdout))
+		}
+		if res.stderr != "" {
+			log.Printf("trigger stderr: %s", strings.TrimSpace(res.stderr))
+		}
+		resChan <- res
+	}()
+	return resChan
+}
+
+// exitCode returns the exit status of a finished command, -1 if it didn't run.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
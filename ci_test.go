@@ -0,0 +1,372 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_checkAssertions(t *testing.T) {
+	assertions, err := parseAssertions([]string{
+		`{"source": ["beta"]}`,
+		`{"detail": {"price": [{"numeric": ["<", 10]}]}}`,
+	})
+	require.NoError(t, err)
+
+	reason, err := checkAssertions(assertions, testEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, `detail.price: 15 does not match [{"numeric":["<",10]}]`, reason)
+
+	reason, err = checkAssertions(assertions[:1], testEvent)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	reason, err = checkAssertions(nil, testEvent)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func Test_parseAssertions(t *testing.T) {
+	assertions, err := parseAssertions([]string{"file://testdata/eventpattern.json"})
+	assert.NoError(t, err)
+	assert.Len(t, assertions, 1)
+
+	_, err = parseAssertions([]string{`{"source": `})
+	assert.Error(t, err)
+
+	_, err = parseAssertions([]string{"file:///nonexistent/assertion.json"})
+	assert.Error(t, err)
+}
+
+func Test_ciPatternFlags(t *testing.T) {
+	ci := commands[slices.IndexFunc(commands, func(c *cli.Command) bool { return c.Name == "ci" })]
+
+	var asserts, expects, vars []string
+	app := &cli.Command{
+		Name:  namespace,
+		Flags: flags,
+		Commands: []*cli.Command{{
+			Name:  ci.Name,
+			Flags: ci.Flags,
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				asserts, expects, vars = cmd.StringSlice("assert"), cmd.StringSlice("expect"), cmd.StringSlice("var")
+				return nil
+			},
+		}},
+	}
+	disableSliceFlagSeparator(app)
+
+	// patterns with several keys or values contain commas, root flags are given after ci too
+	err := app.Run(context.Background(), []string{namespace, "ci",
+		"--assert", `{"source":["beta"],"detail":{"price":[15,16]}}`,
+		"--assert", `{"detail-type":["a","b"]}`,
+		"--expect", `{"source":["alpha","beta"]}`,
+		"--var", "regions=eu-north-1,eu-west-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"source":["beta"],"detail":{"price":[15,16]}}`, `{"detail-type":["a","b"]}`}, asserts)
+	assert.Equal(t, []string{`{"source":["alpha","beta"]}`}, expects)
+	assert.Equal(t, []string{"regions=eu-north-1,eu-west-1"}, vars)
+
+	assertions, err := parseAssertions(asserts)
+	require.NoError(t, err)
+	reason, err := checkAssertions(assertions[:1], testEvent)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func Test_runTrigger(t *testing.T) {
+	t.Run("captures stdout", func(t *testing.T) {
+		res := <-runTrigger(context.Background(), "echo hello")
+		assert.NoError(t, res.check())
+		assert.Equal(t, 0, res.exitCode)
+		assert.Equal(t, "hello", strings.TrimSpace(res.stdout))
+	})
+
+	t.Run("captures exit code", func(t *testing.T) {
+		res := <-runTrigger(context.Background(), "exit 3")
+		assert.Error(t, res.check())
+		assert.Equal(t, 3, res.exitCode)
+	})
+}
+
+func Test_ciDeliveries(t *testing.T) {
+	assertions, err := parseAssertions([]string{`{"detail": {"channel": ["web"]}}`})
+	require.NoError(t, err)
+	d := newCIDeliveries(assertions, nil, false)
+	d.inputs = 1
+
+	assert.False(t, d.onMessage(`{"id": "1", "detail": {"channel": "app"}}`))
+	assert.Empty(t, d.events)
+	assert.Equal(t, []string{`- detail.channel: ["web"]`, `+ detail.channel: "app"`}, d.diff(d.rejected))
+	assert.EqualError(t, d.timeoutError(time.Second), `CI failed - no event satisfied the assertions within 1s: detail.channel: "app" does not match ["web"]`)
+	assert.Equal(t, exitAssertionFailure, exitCodeOf(d.timeoutError(time.Second)))
+
+	assert.False(t, d.onMessage(`{"id": "1", "detail": {"channel": "web"}}`))
+	select {
+	case <-d.completeChan:
+	default:
+		t.Fatal("first event not signalled")
+	}
+	assert.Equal(t, []string{`{"id": "1", "detail": {"channel": "web"}}`}, d.events)
+
+	// a resent copy and a redelivery of the first event
+	assert.False(t, d.onMessage(`{"id": "2", "detail": {"channel": "web"}}`))
+	assert.False(t, d.onMessage(`{"id": "1", "detail": {"channel": "web"}}`))
+	assert.Len(t, d.events, 3)
+	assert.Len(t, d.ids, 2)
+
+	assert.NoError(t, d.finish(nil, nil, 2, 0))
+	assert.NoError(t, d.finish(nil, nil, 2, 3))
+	assert.EqualError(t, d.finish(nil, nil, 2, 1), "CI failed - expected 1 events, received 3")
+
+	t.Run("report", func(t *testing.T) {
+		r := newCIReport()
+		linkedAt := d.firstAt.Add(-5 * time.Second)
+		sentAt := map[string]time.Time{"1": d.firstAt.Add(-200 * time.Millisecond)}
+		d.record(r, linkedAt, sentAt, d.firstAt.Add(-3*time.Second))
+
+		assert.Len(t, r.Events, 3)
+		// the resent copy has its own id, it is a duplicate but not redelivered
+		assert.Equal(t, 2, r.Duplicates)
+		assert.Equal(t, 1, r.Redelivered)
+		assert.Equal(t, int64(5000), r.Timings.TargetActivation)
+		assert.Equal(t, int64(200), r.Timings.FirstDelivery)
+		require.NotNil(t, r.LastRejected)
+		assert.Equal(t, `detail.channel: "app" does not match ["web"]`, r.LastRejected.Reason)
+	})
+}
+
+func Test_ciDeliveriesDistinctEvents(t *testing.T) {
+	for _, inputs := range []int{0, 3} {
+		d := newCIDeliveries(nil, nil, false)
+		d.inputs = inputs
+		for _, id := range []string{"1", "2", "3", "2"} {
+			assert.False(t, d.onMessage(`{"id": "`+id+`", "source": "orders"}`))
+		}
+
+		received, duplicates, redelivered := d.counts()
+		assert.Equal(t, 4, received)
+		assert.Equal(t, 1, duplicates)
+		assert.Equal(t, 1, redelivered)
+	}
+}
+
+func Test_ciDeliveriesResentCopies(t *testing.T) {
+	d := newCIDeliveries(nil, nil, false)
+	d.inputs = 1
+	// the input event and two resent copies, each with the id PutEvents assigned
+	for _, id := range []string{"1", "2", "3"} {
+		assert.False(t, d.onMessage(`{"id": "`+id+`", "source": "orders"}`))
+	}
+
+	received, duplicates, redelivered := d.counts()
+	assert.Equal(t, 3, received)
+	assert.Equal(t, 2, duplicates)
+	assert.Equal(t, 0, redelivered)
+	assert.NoError(t, d.finish(nil, nil, 3, 3))
+	assert.EqualError(t, d.finish(nil, nil, 3, 1), "CI failed - expected 1 events, received 3")
+}
+
+func Test_ciDeliveriesTimeout(t *testing.T) {
+	err := newCIDeliveries(nil, nil, false).timeoutError(time.Second)
+	assert.EqualError(t, err, "CI failed - didn't receive any event within 1s")
+	assert.Equal(t, exitTimeout, exitCodeOf(err))
+}
+
+func Test_ciDeliveriesSteps(t *testing.T) {
+	steps, err := parseAssertions([]string{
+		`{"detail-type": ["OrderReserved"]}`,
+		`{"detail-type": ["OrderPaid"]}`,
+	})
+	require.NoError(t, err)
+
+	closed := func(c chan struct{}) bool {
+		select {
+		case <-c:
+			return true
+		default:
+			return false
+		}
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		d := newCIDeliveries(nil, steps, false)
+
+		assert.False(t, d.onMessage(`{"id": "1", "detail-type": "OrderPlaced"}`))
+		assert.EqualError(t, d.timeoutError(time.Second), `CI failed - no expected event received within 1s: step 1: detail-type: "OrderPlaced" does not match ["OrderReserved"]`)
+
+		assert.False(t, d.onMessage(`{"id": "2", "detail-type": "OrderReserved"}`))
+		assert.True(t, closed(d.receivedChan))
+		assert.False(t, closed(d.completeChan))
+		assert.EqualError(t, d.timeoutError(time.Second), `CI failed - received 1 of 2 expected events within 1s: step 1: detail-type: "OrderPlaced" does not match ["OrderReserved"]`)
+
+		assert.False(t, d.onMessage(`{"id": "3", "detail-type": "OrderPaid"}`))
+		assert.True(t, closed(d.completeChan))
+
+		// duplicates are counted, not failed
+		assert.False(t, d.onMessage(`{"id": "4", "detail-type": "OrderPaid"}`))
+		assert.Len(t, d.events, 3)
+		assert.NoError(t, d.finish(nil, nil, 1, 0))
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		d := newCIDeliveries(nil, steps, false)
+
+		assert.True(t, d.onMessage(`{"id": "1", "detail-type": "OrderPaid"}`))
+		assert.EqualError(t, d.err, "CI failed - step 2 received before step 1")
+		assert.Equal(t, exitAssertionFailure, exitCodeOf(d.err))
+	})
+
+	t.Run("unordered", func(t *testing.T) {
+		d := newCIDeliveries(nil, steps, true)
+
+		assert.False(t, d.onMessage(`{"id": "1", "detail-type": "OrderPaid"}`))
+		assert.False(t, closed(d.completeChan))
+		assert.False(t, d.onMessage(`{"id": "2", "detail-type": "OrderReserved"}`))
+		assert.True(t, closed(d.completeChan))
+	})
+
+	t.Run("assertions apply to every step", func(t *testing.T) {
+		assertions, err := parseAssertions([]string{`{"source": ["orders"]}`})
+		require.NoError(t, err)
+		d := newCIDeliveries(assertions, steps, false)
+
+		assert.False(t, d.onMessage(`{"id": "1", "source": "other", "detail-type": "OrderReserved"}`))
+		assert.False(t, closed(d.receivedChan))
+	})
+}
+
+func Test_validateFlagsCI(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "input event", args: []string{"-i", "{}"}},
+		{name: "trigger", args: []string{"--trigger", "make test"}},
+		{name: "input event and trigger", args: []string{"-i", "{}", "--trigger", "make test"}, err: "can't be used together"},
+		{name: "no input", err: "no input event or trigger provided"},
+		{name: "zero resend interval", args: []string{"-i", "{}", "--resend-interval", "0s"}, err: "--resend-interval must be positive, got 0s"},
+		{name: "negative resend interval", args: []string{"-i", "{}", "--resend-interval", "-1s"}, err: "--resend-interval must be positive, got -1s"},
+		{name: "zero resend interval without resends", args: []string{"-i", "{}", "--resend-interval", "0s", "--no-resend"}},
+		{name: "zero resend interval with a single send", args: []string{"-i", "{}", "--resend-interval", "0s", "--max-sends", "1"}},
+		{name: "unlimited sends", args: []string{"-i", "{}", "--max-sends", "0"}},
+		{name: "negative max sends", args: []string{"-i", "{}", "--max-sends", "-1"}, err: "--max-sends can't be negative, got -1"},
+		{name: "negative drain", args: []string{"-i", "{}", "--drain", "-1s"}, err: "--drain can't be negative, got -1s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			app := &cli.Command{
+				Name: "ci",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "inputevent", Aliases: []string{"i"}},
+					&cli.StringFlag{Name: "trigger"},
+					&cli.DurationFlag{Name: "resend-interval", Value: 3 * time.Second},
+					&cli.IntFlag{Name: "max-sends"},
+					&cli.BoolFlag{Name: "no-resend"},
+					&cli.DurationFlag{Name: "drain"},
+				},
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					err = validateFlags(cmd)
+					return nil
+				},
+			}
+			require.NoError(t, app.Run(context.Background(), append([]string{"ci"}, tt.args...)))
+
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.err)
+			assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+		})
+	}
+}
+
+func Test_validateFlagsStopConditions(t *testing.T) {
+	validate := func(name string, args ...string) error {
+		var err error
+		app := &cli.Command{
+			Name: name,
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "max-events"},
+				&cli.DurationFlag{Name: "duration"},
+				&cli.StringFlag{Name: "until"},
+				&cli.StringFlag{Name: "trigger", Value: "make test"},
+				&cli.BoolFlag{Name: "no-resend", Value: true},
+			},
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				err = validateFlags(cmd)
+				return nil
+			},
+		}
+		require.NoError(t, app.Run(context.Background(), append([]string{name}, args...)))
+		return err
+	}
+
+	assert.NoError(t, validate(namespace, "--max-events", "3", "--duration", "5m", "--until", "{}"))
+	assert.NoError(t, validate("ci"))
+
+	for _, name := range []string{"ci", "wait", "bench"} {
+		err := validate(name, "--until", `{"source": ["orders"]}`)
+		assert.EqualError(t, err, "--until only applies to the listener, not to "+name)
+		assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+	}
+	assert.EqualError(t, validate("wait", "--max-events", "1"), "--max-events only applies to the listener, not to wait")
+	assert.EqualError(t, validate("ci", "--duration", "1m"), "--duration only applies to the listener, not to ci")
+}
+
+func Test_readCIInput(t *testing.T) {
+	read := func(args ...string) (*ciInput, error) {
+		var in *ciInput
+		var err error
+		app := &cli.Command{
+			Name: "ci",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "inputevent"},
+				&cli.StringFlag{Name: "trigger"},
+				&cli.StringSliceFlag{Name: "var"},
+				&cli.StringSliceFlag{Name: "assert"},
+				&cli.StringSliceFlag{Name: "expect"},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				// the account is known, no AWS call is made
+				src := &dataSources{account: "123456789012", region: "eu-north-1"}
+				in, err = readCIInput(ctx, cmd, src, nil, `{"source": ["orders"], "account": ["123456789012"]}`, newCIReport())
+				return nil
+			},
+		}
+		require.NoError(t, app.Run(context.Background(), append([]string{"ci"}, args...)))
+		return in, err
+	}
+
+	in, err := read("--inputevent", `{"Source": "orders", "DetailType": "OrderPlaced", "Detail": "{}"}`, "--assert", `{"source": ["orders"]}`)
+	require.NoError(t, err)
+	assert.Len(t, in.events, 1)
+	assert.Len(t, in.assertions, 1)
+
+	_, err = read("--inputevent", `{"Source": "billing", "DetailType": "OrderPlaced", "Detail": "{}"}`)
+	assert.Equal(t, exitPatternMismatch, exitCodeOf(err))
+
+	// the input starts a flow, the expected events match the rule
+	_, err = read("--inputevent", `{"Source": "billing", "DetailType": "OrderPlaced", "Detail": "{}"}`, "--expect", `{"source": ["orders"]}`)
+	assert.NoError(t, err)
+
+	_, err = read("--inputevent", `{"Source": "orders"`)
+	assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+
+	_, err = read("--trigger", "make test", "--assert", `{"source": `)
+	assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultJUnitPath is where the JUnit report is written under GitLab CI when --junit isn't set.
+const defaultJUnitPath = "eventbridge-cli-junit.xml"
+
+// publishReport reports the CI result natively when running in GitHub Actions or GitLab CI:
+// error annotations and a step summary on GitHub, a JUnit report on GitLab or with junitPath.
+func publishReport(r *ciReport, junitPath string) {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		if r.Status == "failed" {
+			fmt.Println(githubAnnotation(r))
+		}
+		if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+			if err := appendFile(path, markdownSummary(r)); err != nil {
+				log.Printf("failed to write the step summary %s: %v", path, err)
+			}
+		}
+	}
+
+	if junitPath == "" && os.Getenv("GITLAB_CI") == "true" {
+		junitPath = defaultJUnitPath
+	}
+	if junitPath != "" {
+		b, err := junitReport(r)
+		if err == nil {
+			err = os.WriteFile(junitPath, b, 0o644)
+		}
+		if err != nil {
+			log.Printf("failed to write the JUnit report %s: %v", junitPath, err)
+		}
+	}
+}
+
+// githubAnnotation returns the workflow command creating an error annotation for a failed run.
+// https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions#setting-an-error-message
+func githubAnnotation(r *ciReport) string {
+	msg := r.Error
+	if r.LastRejected != nil && len(r.LastRejected.Diff) > 0 {
+		msg += "\n" + strings.Join(r.LastRejected.Diff, "\n")
+	}
+
+	escaper := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	return fmt.Sprintf("::error title=%s ci (exit code %d)::%s", namespace, r.ExitCode, escaper.Replace(msg))
+}
+
+// markdownSummary renders the run for the GitHub step summary.
+func markdownSummary(r *ciReport) string {
+	var b strings.Builder
+
+	switch r.Status {
+	case "passed":
+		fmt.Fprintf(&b, "### :white_check_mark: %s ci passed\n\n", namespace)
+	case "failed":
+		fmt.Fprintf(&b, "### :x: %s ci failed (exit code %d)\n\n", namespace, r.ExitCode)
+		fmt.Fprintf(&b, "> %s\n\n", r.Error)
+	default:
+		fmt.Fprintf(&b, "### :warning: %s ci %s\n\n", namespace, r.Status)
+	}
+
+	row := func(name, value string) {
+		fmt.Fprintf(&b, "| %s | %s |\n", name, strings.ReplaceAll(value, "|", `\|`))
+	}
+	ms := func(v int64) string {
+		return (time.Duration(v) * time.Millisecond).String()
+	}
+
+	b.WriteString("| | |\n| --- | --- |\n")
+	if r.RuleArn != "" {
+		row("Rule", "`"+r.RuleArn+"`")
+	}
+	if r.Trigger != "" {
+		row("Trigger", "`"+r.Trigger+"`")
+	}
+	if r.Sends > 0 {
+		row("Sends", fmt.Sprint(r.Sends))
+	}
+	row("Events received", fmt.Sprintf("%d (%d duplicates, %d redelivered)", len(r.Events), r.Duplicates, r.Redelivered))
+	if r.Timings.FirstDelivery > 0 {
+		row("First delivery latency", ms(r.Timings.FirstDelivery))
+	}
+	if r.Timings.TargetActivation > 0 {
+		row("Target activation", ms(r.Timings.TargetActivation))
+	}
+	if r.Timings.RuleCreation > 0 {
+		row("Rule creation", ms(r.Timings.RuleCreation))
+	}
+	row("Total", ms(r.Timings.Total))
+	row("Cleanup", r.Cleanup.Status)
+	b.WriteString("\n")
+
+	details := func(summary, lang, body string) {
+		fmt.Fprintf(&b, "<details><summary>%s</summary>\n\n```%s\n%s\n```\n\n</details>\n\n", summary, lang, body)
+	}
+
+	if r.EventPattern != "" {
+		details("Event pattern", "json", indentJSON([]byte(r.EventPattern)))
+	}
+	for _, e := range r.InputEvents {
+		details("Input event", "json", indentJSON(e))
+	}
+	for _, e := range r.Events {
+		details("Received event", "json", indentJSON(e))
+	}
+
+	if rej := r.LastRejected; rej != nil {
+		fmt.Fprintf(&b, "#### Last rejected event\n\n%s\n\n", rej.Reason)
+		if len(rej.Diff) > 0 {
+			fmt.Fprintf(&b, "```diff\n%s\n```\n\n", strings.Join(rej.Diff, "\n"))
+		}
+		details("Rejected event", "json", indentJSON(rej.Event))
+	}
+
+	return b.String()
+}
+
+func indentJSON(b []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return string(b)
+	}
+	return buf.String()
+}
+
+func appendFile(path, s string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(s); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// junitReport renders the run as a single test case. Test failures (pattern mismatch, timeout,
+// assertion failure) are reported as failures, anything else as errors.
+func junitReport(r *ciReport) ([]byte, error) {
+	seconds := fmt.Sprintf("%.3f", float64(r.Timings.Total)/1000)
+	tc := junitTestCase{
+		Name:      "event pattern " + compactJSON(r.EventPattern),
+		Classname: namespace + ".ci",
+		Time:      seconds,
+	}
+
+	var out []string
+	for _, e := range r.Events {
+		out = append(out, string(e))
+	}
+	tc.SystemOut = strings.Join(out, "\n")
+
+	suite := junitTestSuite{Name: namespace, Tests: 1, Time: seconds}
+	switch r.Status {
+	case "failed":
+		text := []string{r.Error}
+		if rej := r.LastRejected; rej != nil {
+			text = append(text, "", "last rejected event: "+string(rej.Event))
+			text = append(text, rej.Diff...)
+		}
+		f := &junitFailure{
+			Message: r.Error,
+			Type:    fmt.Sprintf("exit code %d", r.ExitCode),
+			Text:    strings.Join(text, "\n"),
+		}
+		switch r.ExitCode {
+		case exitPatternMismatch, exitTimeout, exitAssertionFailure:
+			tc.Failure, suite.Failures = f, 1
+		default:
+			tc.Error, suite.Errors = f, 1
+		}
+	case "interrupted":
+		tc.Skipped, suite.Skipped = &junitSkipped{Message: "interrupted"}, 1
+	}
+	suite.Cases = []junitTestCase{tc}
+
+	b, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+func compactJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(s)); err != nil {
+		return s
+	}
+	return buf.String()
+}
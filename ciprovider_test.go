@@ -0,0 +1,128 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testFailedReport() *ciReport {
+	r := newCIReport()
+	r.EventPattern = `{"source": ["beta"], "detail": {"channel": ["web"]}}`
+	r.RuleArn = "arn:aws:events:eu-north-1:123456789012:rule/eventbridge-cli-test"
+	r.InputEvents = []json.RawMessage{rawJSON(`{"source": "beta"}`)}
+	r.Sends = 2
+	r.LastRejected = &ciRejection{
+		Event:  rawJSON(`{"source": "beta", "detail": {"channel": "app"}}`),
+		Reason: `detail.channel: "app" does not match ["web"]`,
+		Diff:   []string{`- detail.channel: ["web"]`, `+ detail.channel: "app"`},
+	}
+	r.finish(ciFailure(exitAssertionFailure, errors.New("no event satisfied the assertions within 12s")))
+	return r
+}
+
+func Test_githubAnnotation(t *testing.T) {
+	assert.Equal(t,
+		`::error title=eventbridge-cli ci (exit code 5)::CI failed - no event satisfied the assertions within 12s%0A- detail.channel: ["web"]%0A+ detail.channel: "app"`,
+		githubAnnotation(testFailedReport()))
+}
+
+func Test_markdownSummary(t *testing.T) {
+	t.Run("failed", func(t *testing.T) {
+		md := markdownSummary(testFailedReport())
+		assert.Contains(t, md, "### :x: eventbridge-cli ci failed (exit code 5)")
+		assert.Contains(t, md, "> CI failed - no event satisfied the assertions within 12s")
+		assert.Contains(t, md, "| Rule | `arn:aws:events:eu-north-1:123456789012:rule/eventbridge-cli-test` |")
+		assert.Contains(t, md, "| Events received | 0 (0 duplicates, 0 redelivered) |")
+		assert.Contains(t, md, "```diff\n- detail.channel: [\"web\"]\n+ detail.channel: \"app\"\n```")
+		assert.Contains(t, md, "<summary>Input event</summary>\n\n```json\n{\n  \"source\": \"beta\"\n}\n```")
+	})
+
+	t.Run("passed", func(t *testing.T) {
+		r := newCIReport()
+		r.Trigger = "make produce | tee out.log"
+		r.Events = append(r.Events, rawJSON(testEvent))
+		r.Timings.FirstDelivery = 310
+		r.finish(nil)
+
+		md := markdownSummary(r)
+		assert.Contains(t, md, "### :white_check_mark: eventbridge-cli ci passed")
+		assert.Contains(t, md, "| Trigger | `make produce \\| tee out.log` |")
+		assert.Contains(t, md, "| First delivery latency | 310ms |")
+		assert.Contains(t, md, "<summary>Received event</summary>")
+		assert.NotContains(t, md, "Last rejected event")
+	})
+}
+
+func Test_junitReport(t *testing.T) {
+	parse := func(t *testing.T, r *ciReport) junitTestSuite {
+		b, err := junitReport(r)
+		require.NoError(t, err)
+
+		var suites junitTestSuites
+		require.NoError(t, xml.Unmarshal(b, &suites))
+		require.Len(t, suites.Suites, 1)
+		require.Len(t, suites.Suites[0].Cases, 1)
+		return suites.Suites[0]
+	}
+
+	t.Run("test failure", func(t *testing.T) {
+		suite := parse(t, testFailedReport())
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, 0, suite.Errors)
+
+		tc := suite.Cases[0]
+		assert.Equal(t, `event pattern {"source":["beta"],"detail":{"channel":["web"]}}`, tc.Name)
+		require.NotNil(t, tc.Failure)
+		assert.Equal(t, "exit code 5", tc.Failure.Type)
+		assert.Contains(t, tc.Failure.Text, `+ detail.channel: "app"`)
+	})
+
+	t.Run("infrastructure error", func(t *testing.T) {
+		r := newCIReport()
+		r.finish(errors.New("poller stopped"))
+
+		suite := parse(t, r)
+		assert.Equal(t, 0, suite.Failures)
+		assert.Equal(t, 1, suite.Errors)
+		assert.Equal(t, "exit code 1", suite.Cases[0].Error.Type)
+	})
+
+	t.Run("passed", func(t *testing.T) {
+		r := newCIReport()
+		r.Events = append(r.Events, rawJSON(`{"id": "1"}`))
+		r.finish(nil)
+
+		suite := parse(t, r)
+		assert.Equal(t, 0, suite.Failures+suite.Errors+suite.Skipped)
+		assert.Equal(t, `{"id": "1"}`, suite.Cases[0].SystemOut)
+	})
+}
+
+func Test_publishReport(t *testing.T) {
+	dir := t.TempDir()
+	summary := filepath.Join(dir, "summary.md")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_STEP_SUMMARY", summary)
+	t.Setenv("GITLAB_CI", "")
+
+	junit := filepath.Join(dir, "junit.xml")
+	publishReport(testFailedReport(), junit)
+
+	b, err := os.ReadFile(summary)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "eventbridge-cli ci failed")
+
+	b, err = os.ReadFile(junit)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "<testsuites>")
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cfnTemplate is the subset of a CloudFormation or SAM template read by the 'cfn://' and 'sam://' sources.
+// Values that can hold intrinsic functions are decoded as any and resolved with a cfnResolver.
+type cfnTemplate struct {
+	Parameters map[string]cfnParameter `yaml:"Parameters"`
+	Resources  map[string]struct {
+		Type     string `yaml:"Type"`
+		Metadata struct {
+			// construct path of resources synthesized by the AWS CDK
+			CDKPath string `yaml:"aws:cdk:path"`
+		} `yaml:"Metadata"`
+		Properties struct {
+			// AWS::Events::EventBus
+			Name any `yaml:"Name"`
+
+			// AWS::Events::Rule
+			EventPattern any `yaml:"EventPattern"`
+			EventBusName any `yaml:"EventBusName"`
+
+			// AWS::Serverless::Function, AWS::Serverless::StateMachine
+			Events map[string]samEvent `yaml:"Events"`
+
+			// AWS::Pipes::Pipe
+			SourceParameters struct {
+				FilterCriteria struct {
+					Filters []cfnPipeFilter `yaml:"Filters"`
+				} `yaml:"FilterCriteria"`
+			} `yaml:"SourceParameters"`
+		} `yaml:"Properties"`
+	} `yaml:"Resources"`
+}
+
+type cfnParameter struct {
+	Type    string `yaml:"Type"`
+	Default any    `yaml:"Default"`
+}
+
+type cfnPipeFilter struct {
+	Pattern any `yaml:"Pattern"`
+}
+
+// samEvent is an event source of a SAM function or state machine.
+type samEvent struct {
+	Type       string `yaml:"Type"`
+	Properties struct {
+		EventBusName any    `yaml:"EventBusName,omitempty"`
+		InputPath    string `yaml:"InputPath,omitempty"`
+		Pattern      any    `yaml:"Pattern,omitempty"`
+	} `yaml:"Properties"`
+}
+
+// loadTemplate reads a CloudFormation template, YAML or JSON. Short-form tags (ie. !Ref, !Sub)
+// are rewritten to their long form so they can be resolved.
+func loadTemplate(path string) (*cfnTemplate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+	expandShortForm(&root)
+
+	t := &cfnTemplate{}
+	if err := root.Decode(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// expandShortForm replaces the nodes tagged with a short-form intrinsic function, ie. '!GetAtt Bus.Arn',
+// with the equivalent long-form mapping, ie. '{"Fn::GetAtt": ["Bus", "Arn"]}'.
+func expandShortForm(n *yaml.Node) {
+	for _, c := range n.Content {
+		expandShortForm(c)
+	}
+
+	if !strings.HasPrefix(n.Tag, "!") || strings.HasPrefix(n.Tag, "!!") {
+		return
+	}
+
+	fn := strings.TrimPrefix(n.Tag, "!")
+	if fn != "Ref" && fn != "Condition" {
+		fn = "Fn::" + fn
+	}
+
+	value := *n
+	value.Tag = ""
+	if fn == "Fn::GetAtt" && value.Kind == yaml.ScalarNode {
+		resource, attribute, _ := strings.Cut(value.Value, ".")
+		value = yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: resource},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: attribute},
+		}}
+	}
+
+	*n = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: fn},
+		&value,
+	}}
+}
+
+// cfn://template.yaml/LogicalId, or cfn://template.yaml/StateMachine/EventName
+func dataFromCFN(ctx context.Context, src *dataSources, cfnpath string) (string, string, error) {
+	template, refs, err := splitTemplatePath(strings.TrimPrefix(cfnpath, "cfn://"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(refs) > 2 {
+		return "", "", fmt.Errorf("invalid cfn source %q, expected cfn://<template>/<logical_id>", cfnpath)
+	}
+
+	t, err := loadTemplate(template)
+	if err != nil {
+		return "", "", err
+	}
+
+	logicalID, eventName := refs[0], ""
+	if len(refs) > 1 {
+		eventName = refs[1]
+	}
+	if _, ok := t.Resources[logicalID]; !ok {
+		return "", "", fmt.Errorf("resource %s not found in %s", logicalID, template)
+	}
+
+	return newCFNResolver(ctx, src, t).resourcePattern(logicalID, eventName)
+}
+
+// resourcePattern returns the event pattern and bus of a rule, state machine event or pipe.
+func (r *cfnResolver) resourcePattern(logicalID, eventName string) (string, string, error) {
+	res := r.template.Resources[logicalID]
+	if res.Type != "AWS::Serverless::StateMachine" && eventName != "" {
+		return "", "", fmt.Errorf("resource %s is of type %s, only state machine events can be selected", logicalID, res.Type)
+	}
+
+	switch res.Type {
+	case "AWS::Events::Rule":
+		if res.Properties.EventPattern == nil {
+			return "", "", fmt.Errorf("rule %s has no event pattern, schedule rules can't be listened to", logicalID)
+		}
+		return r.pattern(res.Properties.EventPattern, res.Properties.EventBusName)
+
+	case "AWS::Serverless::StateMachine":
+		e, err := selectEventBridgeEvent(logicalID, res.Properties.Events, eventName)
+		if err != nil {
+			return "", "", err
+		}
+		return r.pattern(e.Properties.Pattern, e.Properties.EventBusName)
+
+	case "AWS::Pipes::Pipe":
+		return pipePattern(r, logicalID, res.Properties.SourceParameters.FilterCriteria.Filters)
+	}
+
+	return "", "", fmt.Errorf("resource %s is of type %s, expected AWS::Events::Rule, AWS::Serverless::StateMachine or AWS::Pipes::Pipe", logicalID, res.Type)
+}
+
+// pipePattern returns the pipe filter pattern. Events pass a pipe when they match any of its
+// filters, so several filters are combined with $or.
+func pipePattern(r *cfnResolver, logicalID string, filters []cfnPipeFilter) (string, string, error) {
+	if len(filters) == 0 {
+		return "", "", fmt.Errorf("pipe %s has no filter criteria", logicalID)
+	}
+
+	patterns := make([]json.RawMessage, 0, len(filters))
+	for _, f := range filters {
+		pattern, _, err := r.pattern(f.Pattern, nil)
+		if err != nil {
+			return "", "", fmt.Errorf("pipe %s: %w", logicalID, err)
+		}
+		patterns = append(patterns, json.RawMessage(pattern))
+	}
+	if len(patterns) == 1 {
+		return string(patterns[0]), "", nil
+	}
+
+	b, err := json.Marshal(map[string][]json.RawMessage{"$or": patterns})
+	return string(b), "", err
+}
+
+// selectEventBridgeEvent returns the EventBridge event of a SAM resource: the one named, or the only one.
+func selectEventBridgeEvent(resource string, events map[string]samEvent, name string) (samEvent, error) {
+	var names []string
+	for n, e := range events {
+		// CloudWatchEvent is the legacy name of EventBridgeRule
+		if e.Type == "EventBridgeRule" || e.Type == "CloudWatchEvent" {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+
+	switch {
+	case name != "":
+		if !slices.Contains(names, name) {
+			return samEvent{}, fmt.Errorf("%s has no EventBridgeRule event %s, choose one of: %s", resource, name, strings.Join(names, ", "))
+		}
+		return events[name], nil
+	case len(names) == 0:
+		return samEvent{}, fmt.Errorf("%s has no EventBridgeRule event", resource)
+	case len(names) > 1:
+		return samEvent{}, fmt.Errorf("%s has %d EventBridgeRule events, choose one of: %s", resource, len(names), strings.Join(names, ", "))
+	}
+
+	return events[names[0]], nil
+}
+
+// patternJSON marshals a template pattern, either an object or a JSON string.
+func patternJSON(v any) (string, error) {
+	if s, ok := v.(string); ok {
+		if !json.Valid([]byte(s)) {
+			return "", fmt.Errorf("event pattern is not valid JSON: %s", s)
+		}
+		return s, nil
+	}
+
+	b, err := json.Marshal(convertMap(v))
+	return string(b), err
+}
+
+// splitTemplatePath splits a source path into the template file and the references within it,
+// ie. dir/template.yaml/Resource/Event into dir/template.yaml and [Resource Event].
+func splitTemplatePath(p string) (string, []string, error) {
+	parts := strings.Split(p, "/")
+	for i := len(parts) - 1; i > 0; i-- {
+		file := strings.Join(parts[:i], "/")
+		if fi, err := os.Stat(file); err == nil && fi.Mode().IsRegular() {
+			return file, parts[i:], nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("no template file found in %s", p)
+}
+
+// cfnResolver evaluates the intrinsic functions of a template: Ref, Fn::Sub, Fn::GetAtt, Fn::Join
+// and Fn::ImportValue. Values come from --parameter-overrides, the pseudo parameters and
+// the template parameter defaults. Anything else can't be resolved locally and is an error.
+type cfnResolver struct {
+	ctx      context.Context
+	src      *dataSources
+	template *cfnTemplate
+}
+
+func newCFNResolver(ctx context.Context, src *dataSources, t *cfnTemplate) *cfnResolver {
+	return &cfnResolver{ctx: ctx, src: src, template: t}
+}
+
+// pattern resolves an event pattern and its optional event bus name.
+func (r *cfnResolver) pattern(pattern, eventBus any) (string, string, error) {
+	p, err := r.resolve(pattern)
+	if err != nil {
+		return "", "", fmt.Errorf("event pattern: %w", err)
+	}
+	s, err := patternJSON(p)
+	if err != nil {
+		return "", "", err
+	}
+
+	if eventBus == nil {
+		return s, "", nil
+	}
+	bus, err := r.resolveString(eventBus)
+	if err != nil {
+		return "", "", fmt.Errorf("event bus name: %w", err)
+	}
+	return s, bus, nil
+}
+
+// resolve returns v with every intrinsic function replaced by its value.
+func (r *cfnResolver) resolve(v any) (any, error) {
+	switch x := v.(type) {
+	case map[string]any:
+		if len(x) == 1 {
+			for fn, arg := range x {
+				if fn == "Ref" || strings.HasPrefix(fn, "Fn::") {
+					return r.intrinsic(fn, arg)
+				}
+			}
+		}
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			resolved, err := r.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+
+	case []any:
+		l := make([]any, 0, len(x))
+		for _, e := range x {
+			resolved, err := r.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, resolved)
+		}
+		return l, nil
+	}
+
+	return v, nil
+}
+
+func (r *cfnResolver) resolveString(v any) (string, error) {
+	resolved, err := r.resolve(v)
+	if err != nil {
+		return "", err
+	}
+	switch x := resolved.(type) {
+	case string:
+		return x, nil
+	case int, float64, bool:
+		return fmt.Sprint(x), nil
+	}
+	return "", fmt.Errorf("expected a string, got %v", resolved)
+}
+
+func (r *cfnResolver) resolveList(v any) ([]any, error) {
+	resolved, err := r.resolve(v)
+	if err != nil {
+		return nil, err
+	}
+	l, ok := resolved.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %v", resolved)
+	}
+	return l, nil
+}
+
+func (r *cfnResolver) intrinsic(fn string, arg any) (any, error) {
+	switch fn {
+	case "Ref":
+		name, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid Ref %v", arg)
+		}
+		return r.ref(name)
+
+	case "Fn::GetAtt":
+		var resource, attribute string
+		switch x := arg.(type) {
+		case string:
+			resource, attribute, _ = strings.Cut(x, ".")
+		case []any:
+			if len(x) == 2 {
+				resource, _ = x[0].(string)
+				attribute, _ = r.resolveString(x[1])
+			}
+		}
+		if resource == "" || attribute == "" {
+			return nil, fmt.Errorf("invalid Fn::GetAtt %v", arg)
+		}
+		return r.getAtt(resource, attribute)
+
+	case "Fn::Sub":
+		return r.sub(arg)
+
+	case "Fn::Join":
+		args, ok := arg.([]any)
+		if !ok || len(args) != 2 {
+			return nil, fmt.Errorf("invalid Fn::Join %v", arg)
+		}
+		delimiter, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid Fn::Join delimiter %v", args[0])
+		}
+		values, err := r.resolveList(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("Fn::Join: %w", err)
+		}
+		s := make([]string, 0, len(values))
+		for _, v := range values {
+			e, err := r.resolveString(v)
+			if err != nil {
+				return nil, fmt.Errorf("Fn::Join: %w", err)
+			}
+			s = append(s, e)
+		}
+		return strings.Join(s, delimiter), nil
+
+	case "Fn::ImportValue":
+		name, err := r.resolveString(arg)
+		if err != nil {
+			return nil, fmt.Errorf("Fn::ImportValue: %w", err)
+		}
+		if v, ok := r.src.parameters[name]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Fn::ImportValue %s can't be resolved, set the export value with --parameter-overrides %s=<value>", name, name)
+	}
+
+	return nil, fmt.Errorf("%s can't be resolved", fn)
+}
+
+// ref resolves a parameter, a pseudo parameter or an event bus name.
+func (r *cfnResolver) ref(name string) (any, error) {
+	if v, ok := r.src.parameters[name]; ok {
+		return r.parameterValue(name, v), nil
+	}
+
+	switch name {
+	case "AWS::Region", "AWS::Partition", "AWS::URLSuffix":
+		if err := r.src.connect(r.ctx); err != nil {
+			return nil, fmt.Errorf("Ref %s: %w", name, err)
+		}
+	}
+
+	switch name {
+	case "AWS::Region":
+		if r.src.region == "" {
+			return nil, fmt.Errorf("Ref %s can't be resolved, no region configured", name)
+		}
+		return r.src.region, nil
+	case "AWS::AccountId":
+		return r.src.accountID(r.ctx)
+	case "AWS::Partition":
+		return partition(r.src.region), nil
+	case "AWS::URLSuffix":
+		if partition(r.src.region) == "aws-cn" {
+			return "amazonaws.com.cn", nil
+		}
+		return "amazonaws.com", nil
+	}
+
+	if p, ok := r.template.Parameters[name]; ok {
+		if p.Default == nil {
+			return nil, fmt.Errorf("parameter %s has no default, set it with --parameter-overrides %s=<value>", name, name)
+		}
+		return r.parameterValue(name, fmt.Sprint(p.Default)), nil
+	}
+
+	if res, ok := r.template.Resources[name]; ok && res.Type == "AWS::Events::EventBus" {
+		return r.resolveString(res.Properties.Name)
+	}
+
+	return nil, fmt.Errorf("Ref %s can't be resolved, set it with --parameter-overrides %s=<value>", name, name)
+}
+
+// parameterValue splits the value of list parameters.
+func (r *cfnResolver) parameterValue(name, v string) any {
+	t := r.template.Parameters[name].Type
+	if t != "CommaDelimitedList" && !strings.HasPrefix(t, "List<") {
+		return v
+	}
+
+	var l []any
+	for _, e := range strings.Split(v, ",") {
+		l = append(l, strings.TrimSpace(e))
+	}
+	return l
+}
+
+// getAtt resolves the name and ARN of event buses, other attributes must be overridden.
+func (r *cfnResolver) getAtt(resource, attribute string) (any, error) {
+	key := resource + "." + attribute
+	if v, ok := r.src.parameters[key]; ok {
+		return v, nil
+	}
+
+	if res, ok := r.template.Resources[resource]; ok && res.Type == "AWS::Events::EventBus" {
+		name, err := r.resolveString(res.Properties.Name)
+		if err != nil {
+			return nil, err
+		}
+		switch attribute {
+		case "Name":
+			return name, nil
+		case "Arn":
+			return r.sub("arn:${AWS::Partition}:events:${AWS::Region}:${AWS::AccountId}:event-bus/" + name)
+		}
+	}
+
+	return nil, fmt.Errorf("Fn::GetAtt %s can't be resolved, set it with --parameter-overrides %s=<value>", key, key)
+}
+
+var subVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+func (r *cfnResolver) sub(arg any) (any, error) {
+	var template string
+	vars := map[string]string{}
+
+	switch x := arg.(type) {
+	case string:
+		template = x
+	case []any:
+		if len(x) != 2 {
+			return nil, fmt.Errorf("invalid Fn::Sub %v", arg)
+		}
+		template, _ = x[0].(string)
+		m, ok := x[1].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid Fn::Sub variables %v", x[1])
+		}
+		for k, v := range m {
+			s, err := r.resolveString(v)
+			if err != nil {
+				return nil, fmt.Errorf("Fn::Sub variable %s: %w", k, err)
+			}
+			vars[k] = s
+		}
+	default:
+		return nil, fmt.Errorf("invalid Fn::Sub %v", arg)
+	}
+
+	var err error
+	s := subVariable.ReplaceAllStringFunc(template, func(m string) string {
+		name := m[2 : len(m)-1]
+		if strings.HasPrefix(name, "!") {
+			// ${!Literal} is written as ${Literal}
+			return "${" + name[1:] + "}"
+		}
+		if v, ok := vars[name]; ok {
+			return v
+		}
+
+		var v any
+		var e error
+		if resource, attribute, ok := strings.Cut(name, "."); ok && !strings.HasPrefix(name, "AWS::") {
+			v, e = r.getAtt(resource, attribute)
+		} else {
+			v, e = r.ref(name)
+		}
+		if e == nil {
+			var s string
+			if s, e = r.resolveString(v); e == nil {
+				return s
+			}
+		}
+		if err == nil {
+			err = e
+		}
+		return m
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Fn::Sub: %w", err)
+	}
+	return s, nil
+}
+
+// partition returns the AWS partition of region.
+func partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
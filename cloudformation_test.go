@@ -0,0 +1,239 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dataFromCFN(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "events rule",
+			source:  "cfn://testdata/cloudformation.yaml/BetaRule",
+			pattern: `{"source":["beta"],"detail":{"channel":["web"]}}`,
+			bus:     "fishnchips-eventbus",
+		},
+		{
+			name:    "events rule with a JSON string pattern",
+			source:  "cfn://testdata/cloudformation.yaml/GammaRule",
+			pattern: `{"source":["gamma"]}`,
+		},
+		{
+			name:   "schedule rule",
+			source: "cfn://testdata/cloudformation.yaml/NightlyRule",
+			err:    "rule NightlyRule has no event pattern",
+		},
+		{
+			name:    "state machine event",
+			source:  "cfn://testdata/cloudformation.yaml/BetaStateMachine/Succeeded",
+			pattern: `{"source":["beta"],"detail-type":["poc.succeeded"]}`,
+			bus:     "fishnchips-eventbus",
+		},
+		{
+			name:   "state machine with several events",
+			source: "cfn://testdata/cloudformation.yaml/BetaStateMachine",
+			err:    "BetaStateMachine has 2 EventBridgeRule events, choose one of: Failed, Succeeded",
+		},
+		{
+			name:   "state machine schedule event",
+			source: "cfn://testdata/cloudformation.yaml/BetaStateMachine/Nightly",
+			err:    "BetaStateMachine has no EventBridgeRule event Nightly",
+		},
+		{
+			name:    "pipe filters",
+			source:  "cfn://testdata/cloudformation.yaml/BetaPipe",
+			pattern: `{"$or":[{"body":{"channel":["web"]}},{"body":{"channel":["mobile"]}}]}`,
+		},
+		{
+			name:   "event of a rule",
+			source: "cfn://testdata/cloudformation.yaml/BetaRule/Succeeded",
+			err:    "only state machine events can be selected",
+		},
+		{
+			name:   "missing resource",
+			source: "cfn://testdata/cloudformation.yaml/MissingRule",
+			err:    "resource MissingRule not found",
+		},
+		{
+			name:   "unsupported resource",
+			source: "cfn://testdata/template.yaml/BetaFunction",
+			err:    "resource BetaFunction is of type AWS::Serverless::Function",
+		},
+		{
+			name:   "missing template",
+			source: "cfn://testdata/missing.yaml/BetaRule",
+			err:    "no template file found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := resolveEventPattern(context.Background(), &dataSources{}, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
+
+func Test_splitTemplatePath(t *testing.T) {
+	file, refs, err := splitTemplatePath("testdata/cloudformation.yaml/BetaStateMachine/Succeeded")
+	assert.NoError(t, err)
+	assert.Equal(t, "testdata/cloudformation.yaml", file)
+	assert.Equal(t, []string{"BetaStateMachine", "Succeeded"}, refs)
+
+	// a directory isn't a template
+	_, _, err = splitTemplatePath("testdata/BetaRule")
+	assert.Error(t, err)
+}
+
+type mockCallerIdentityAPI struct {
+	calls int
+}
+
+func (m *mockCallerIdentityAPI) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	m.calls++
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012")}, nil
+}
+
+func Test_cfnIntrinsics(t *testing.T) {
+	src := &dataSources{
+		identity: &mockCallerIdentityAPI{},
+		region:   "eu-north-1",
+		parameters: map[string]string{
+			"AWS::StackName":     "shop",
+			"prod-orders-source": "shop.orders",
+		},
+	}
+	with := func(parameters map[string]string) *dataSources {
+		s := *src
+		s.parameters = map[string]string{}
+		for k, v := range src.parameters {
+			s.parameters[k] = v
+		}
+		for k, v := range parameters {
+			s.parameters[k] = v
+		}
+		return &s
+	}
+
+	tests := []struct {
+		name    string
+		src     *dataSources
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "Ref, Sub, Join, pseudo parameters and defaults",
+			src:     src,
+			source:  "cfn://testdata/intrinsics.yaml/OrdersRule",
+			pattern: `{"source":["shop.orders"],"detail-type":["order.dev.paid"],"detail":{"channel":["web","mobile"],"region":["eu-north-1"]}}`,
+			bus:     "orders-dev",
+		},
+		{
+			name:    "parameter overrides",
+			src:     with(map[string]string{"Stage": "prod", "Channels": "web"}),
+			source:  "cfn://testdata/intrinsics.yaml/OrdersRule",
+			pattern: `{"source":["shop.orders"],"detail-type":["order.prod.paid"],"detail":{"channel":["web"],"region":["eu-north-1"]}}`,
+			bus:     "orders-prod",
+		},
+		{
+			name:    "GetAtt, ImportValue and account",
+			src:     with(map[string]string{"Stage": "prod"}),
+			source:  "cfn://testdata/intrinsics.yaml/OrdersArnRule",
+			pattern: `{"account":["123456789012"],"source":["shop.orders"]}`,
+			bus:     "arn:aws:events:eu-north-1:123456789012:event-bus/orders-prod",
+		},
+		{
+			name:   "unresolved import",
+			src:    src,
+			source: "cfn://testdata/intrinsics.yaml/OrdersArnRule",
+			err:    "Fn::ImportValue dev-orders-source can't be resolved",
+		},
+		{
+			name:   "parameter without default",
+			src:    src,
+			source: "cfn://testdata/intrinsics.yaml/TeamRule",
+			err:    "parameter Team has no default",
+		},
+		{
+			name:    "parameter without default overridden",
+			src:     with(map[string]string{"Team": "payments"}),
+			source:  "cfn://testdata/intrinsics.yaml/TeamRule",
+			pattern: `{"source":["payments.events"]}`,
+		},
+		{
+			name:   "unsupported function",
+			src:    src,
+			source: "cfn://testdata/intrinsics.yaml/ConditionalRule",
+			err:    "Fn::If can't be resolved",
+		},
+		{
+			name:   "unset stack name",
+			src:    &dataSources{region: "eu-north-1"},
+			source: "cfn://testdata/intrinsics.yaml/OrdersRule",
+			err:    "Ref AWS::StackName can't be resolved",
+		},
+		{
+			name:    "SAM function event",
+			src:     src,
+			source:  "sam://testdata/intrinsics.yaml/OrdersFunction",
+			pattern: `{"source":["shop.orders"],"detail":{"literal":["${Stage}"]}}`,
+			bus:     "orders-dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := resolveEventPattern(context.Background(), tt.src, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
+
+func Test_dataSourcesAccountID(t *testing.T) {
+	identity := &mockCallerIdentityAPI{}
+	src := &dataSources{identity: identity}
+
+	for range 2 {
+		account, err := src.accountID(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "123456789012", account)
+	}
+	// looked up once
+	assert.Equal(t, 1, identity.calls)
+
+	_, err := (&dataSources{}).accountID(context.Background())
+	assert.ErrorContains(t, err, "AWS::AccountId can't be resolved")
+}
+
+func Test_partition(t *testing.T) {
+	assert.Equal(t, "aws", partition("eu-north-1"))
+	assert.Equal(t, "aws-cn", partition("cn-north-1"))
+	assert.Equal(t, "aws-us-gov", partition("us-gov-west-1"))
+}
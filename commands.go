@@ -10,6 +10,34 @@ var commands = []*cli.Command{
 		Flags:       flagsCI,
 		Action:      run,
 	},
+	{
+		Name:        "wait",
+		Usage:       "AWS EventBridge cli - wait for an event",
+		Description: "run eventbridge-cli until an event matching the pattern is emitted by other sources",
+		Flags:       flagsWait,
+		Action:      run,
+	},
+	{
+		Name:        "bench",
+		Usage:       "AWS EventBridge cli - load generator",
+		Description: "publish events at a target rate and measure delivery latency, duplicates and losses",
+		Flags:       flagsBench,
+		Action:      run,
+	},
+	{
+		Name:        "canary",
+		Usage:       "AWS EventBridge cli - synthetic canary",
+		Description: "periodically send a synthetic event, wait for its delivery and expose the results as Prometheus metrics",
+		Flags:       flagsCanary,
+		Action:      run,
+	},
+	{
+		Name:        "put",
+		Usage:       "AWS EventBridge cli - put events",
+		Description: "send input events to the event bus and print their ids",
+		Flags:       flagsPut,
+		Action:      runPut,
+	},
 	{
 		Name:        "test-event",
 		Usage:       "AWS EventBridge test-event",
@@ -17,4 +45,37 @@ var commands = []*cli.Command{
 		Flags:       flagsTestEventPattern,
 		Action:      runTestEventPattern,
 	},
+	{
+		Name:        "pattern",
+		Usage:       "AWS EventBridge cli - event pattern tools",
+		Description: "format, lint and explain the event pattern given as argument or with --eventpattern, without creating any resource",
+		Commands: []*cli.Command{
+			{
+				Name:      "fmt",
+				Usage:     "print the pattern with sorted keys and values",
+				ArgsUsage: "[pattern]",
+				Flags:     flagsPatternFmt,
+				Action:    runPatternFmt,
+			},
+			{
+				Name:      "lint",
+				Usage:     "check the pattern syntax and EventBridge limits",
+				ArgsUsage: "[pattern]",
+				Flags:     flagsPatternLint,
+				Action:    runPatternLint,
+			},
+			{
+				Name:      "explain",
+				Usage:     "describe the events the pattern matches in plain English",
+				ArgsUsage: "[pattern]",
+				Action:    runPatternExplain,
+			},
+		},
+	},
+	{
+		Name:        "doctor",
+		Usage:       "AWS EventBridge cli - preflight checks",
+		Description: "check credentials, region, event bus and permissions without creating any resource",
+		Action:      runDoctor,
+	},
 }
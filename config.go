@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the name of the project and user config files.
+const configFile = ".eventbridge-cli.yaml"
+
+// projectConfig holds named presets of flags, and CI suites for the 'ci' command.
+//
+//	presets:
+//	  orders-dev:
+//	    profile: dev
+//	    eventpattern: sam://template.yaml/OrdersFunction
+//	suites:
+//	  order-paid:
+//	    preset: orders-dev
+//	    inputevent: file://testdata/order_paid.json
+type projectConfig struct {
+	Presets map[string]map[string]any `yaml:"presets"`
+	Suites  map[string]configSuite    `yaml:"suites"`
+}
+
+// configSuite is a preset of 'ci' flags, on top of the flags of another preset.
+type configSuite struct {
+	Preset string         `yaml:"preset"`
+	Flags  map[string]any `yaml:",inline"`
+}
+
+// applyConfig sets the flags of the --preset, and of the ci --suite, not given on the command line
+// or through the environment.
+func applyConfig(ctx context.Context, root *cli.Command) (context.Context, error) {
+	// Before runs once parsing is done, the subcommand flags are already set
+	cmd := root
+	for sub := cmd.Command(cmd.Args().First()); sub != nil; sub = cmd.Command(cmd.Args().First()) {
+		cmd = sub
+	}
+
+	presetName, suiteName := root.String("preset"), ""
+	if findFlag(cmd, "suite") != nil {
+		suiteName = cmd.String("suite")
+	}
+	if presetName == "" && suiteName == "" {
+		return ctx, nil
+	}
+
+	cfg, files, err := loadConfig()
+	if err != nil {
+		return ctx, &exitError{code: exitInvalidInput, err: err}
+	}
+	if len(files) == 0 {
+		return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("no %s found in the repository or home directory", configFile)}
+	}
+
+	values := map[string]any{}
+	var suite configSuite
+	if suiteName != "" {
+		var ok bool
+		if suite, ok = cfg.Suites[suiteName]; !ok {
+			return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("suite %s not found in %s, choose one of: %s", suiteName, strings.Join(files, ", "), strings.Join(slices.Sorted(maps.Keys(cfg.Suites)), ", "))}
+		}
+		// --preset overrides the suite preset
+		if presetName == "" {
+			presetName = suite.Preset
+		}
+	}
+	if presetName != "" {
+		preset, ok := cfg.Presets[presetName]
+		if !ok {
+			return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("preset %s not found in %s, choose one of: %s", presetName, strings.Join(files, ", "), strings.Join(slices.Sorted(maps.Keys(cfg.Presets)), ", "))}
+		}
+		maps.Copy(values, preset)
+	}
+	maps.Copy(values, suite.Flags)
+
+	known := flagNames(root)
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if !known[name] {
+			where := "preset " + presetName
+			if _, ok := suite.Flags[name]; ok {
+				where = "suite " + suiteName
+			}
+			return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("unknown flag %s in %s", name, where)}
+		}
+		// presets are shared by commands, ie. timeout only applies to ci
+		f := findFlag(cmd, name)
+		if f == nil || cmd.IsSet(name) {
+			continue
+		}
+
+		_, slice := f.(*cli.StringSliceFlag)
+		strs, err := configValues(values[name], slice)
+		if err != nil {
+			return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("flag %s: %w", name, err)}
+		}
+		for _, s := range strs {
+			if err := cmd.Set(name, s); err != nil {
+				return ctx, &exitError{code: exitInvalidInput, err: fmt.Errorf("flag %s: %w", name, err)}
+			}
+		}
+	}
+
+	return ctx, nil
+}
+
+// loadConfig reads the config file of the user home directory, then the one of the repository,
+// whose presets and suites replace the home ones of the same name.
+func loadConfig() (*projectConfig, []string, error) {
+	var paths []string
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, configFile))
+	}
+	if p, ok := repoConfigPath(); ok && !slices.Contains(paths, p) {
+		paths = append(paths, p)
+	}
+
+	cfg := &projectConfig{Presets: map[string]map[string]any{}, Suites: map[string]configSuite{}}
+	var files []string
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c := &projectConfig{}
+		if err := yaml.Unmarshal(content, c); err != nil {
+			return nil, nil, fmt.Errorf("invalid config %s: %w", p, err)
+		}
+		maps.Copy(cfg.Presets, c.Presets)
+		maps.Copy(cfg.Suites, c.Suites)
+		files = append(files, p)
+	}
+
+	return cfg, files, nil
+}
+
+// repoConfigPath looks for the config file from the working directory up to the repository root.
+func repoConfigPath() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		p := filepath.Join(dir, configFile)
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+		// stop at the repository root
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// configValues converts a config value to flag values: one per item of a list for slice flags.
+// Objects and lists, ie. event patterns, are passed as JSON.
+func configValues(v any, slice bool) ([]string, error) {
+	if l, ok := v.([]any); ok && slice {
+		values := make([]string, 0, len(l))
+		for _, e := range l {
+			s, err := configValues(e, false)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s...)
+		}
+		return values, nil
+	}
+
+	switch v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(b)}, nil
+	}
+	return []string{fmt.Sprint(v)}, nil
+}
+
+// findFlag returns the flag applying to cmd, defined by it or one of its parents.
+func findFlag(cmd *cli.Command, name string) cli.Flag {
+	for _, c := range cmd.Lineage() {
+		for _, f := range c.Flags {
+			if slices.Contains(f.Names(), name) {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// flagNames returns the names of the flags of every command.
+func flagNames(cmd *cli.Command) map[string]bool {
+	names := map[string]bool{}
+	for _, f := range cmd.Flags {
+		for _, n := range f.Names() {
+			names[n] = true
+		}
+	}
+	for _, sub := range cmd.Commands {
+		maps.Copy(names, flagNames(sub))
+	}
+	return names
+}
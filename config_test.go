@@ -0,0 +1,230 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v3"
+)
+
+const testProjectConfig = `
+presets:
+  orders-dev:
+    profile: dev
+    eventpattern:
+      source:
+        - orders
+    var:
+      - stage=dev
+      - region=eu-north-1
+    timeout: 30
+  orders-prod:
+    profile: prod
+suites:
+  order-paid:
+    preset: orders-dev
+    inputevent: file://testdata/order_paid.json
+    expect:
+      - detail-type: [order.paid]
+      - detail-type: [order.shipped]
+  typo:
+    preset: orders-dev
+    timeuot: 5
+`
+
+const testHomeConfig = `
+presets:
+  orders-dev:
+    profile: home
+  personal:
+    region: eu-west-1
+`
+
+// configTestApp is a subset of the cli, recording the flags the action is run with.
+func configTestApp(got map[string]any) *cli.Command {
+	record := func(_ context.Context, cmd *cli.Command) error {
+		for _, name := range []string{"profile", "region", "eventpattern", "var", "timeout", "inputevent", "expect"} {
+			if findFlag(cmd, name) != nil {
+				got[name] = cmd.Value(name)
+			}
+		}
+		return nil
+	}
+
+	return &cli.Command{
+		Name:   namespace,
+		Before: applyConfig,
+		Action: record,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "preset"},
+			&cli.StringFlag{Name: "profile", Aliases: []string{"p"}},
+			&cli.StringFlag{Name: "region"},
+			&cli.StringFlag{Name: "eventpattern", Value: "{}"},
+			&cli.StringSliceFlag{Name: "var"},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:   "ci",
+				Action: record,
+				Flags: []cli.Flag{
+					&cli.Int64Flag{Name: "timeout", Value: 12},
+					&cli.StringFlag{Name: "inputevent"},
+					&cli.StringSliceFlag{Name: "expect"},
+					&cli.StringFlag{Name: "suite"},
+				},
+				DisableSliceFlagSeparator: true,
+			},
+		},
+		DisableSliceFlagSeparator: true,
+	}
+}
+
+// withConfig runs the test in a repository subdirectory, with the config files of the repository and home.
+func withConfig(t *testing.T, project, home string) {
+	t.Helper()
+
+	repo, homeDir := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0o755))
+	assert.NoError(t, os.Mkdir(filepath.Join(repo, "service"), 0o755))
+	if project != "" {
+		assert.NoError(t, os.WriteFile(filepath.Join(repo, configFile), []byte(project), 0o644))
+	}
+	if home != "" {
+		assert.NoError(t, os.WriteFile(filepath.Join(homeDir, configFile), []byte(home), 0o644))
+	}
+
+	t.Chdir(filepath.Join(repo, "service"))
+	t.Setenv("HOME", homeDir)
+}
+
+func Test_applyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		home    string
+		args    []string
+		want    map[string]any
+		err     string
+	}{
+		{
+			name:    "no preset",
+			project: testProjectConfig,
+			args:    []string{"-p", "cli"},
+			want:    map[string]any{"profile": "cli", "region": "", "eventpattern": "{}", "var": []string{}},
+		},
+		{
+			name:    "preset",
+			project: testProjectConfig,
+			args:    []string{"--preset", "orders-dev"},
+			want:    map[string]any{"profile": "dev", "region": "", "eventpattern": `{"source":["orders"]}`, "var": []string{"stage=dev", "region=eu-north-1"}},
+		},
+		{
+			name:    "flags override the preset",
+			project: testProjectConfig,
+			args:    []string{"--preset", "orders-dev", "-p", "cli", "--var", "stage=test"},
+			want:    map[string]any{"profile": "cli", "region": "", "eventpattern": `{"source":["orders"]}`, "var": []string{"stage=test"}},
+		},
+		{
+			name:    "preset command flags",
+			project: testProjectConfig,
+			args:    []string{"--preset", "orders-dev", "ci", "-inputevent", "{}"},
+			want: map[string]any{"profile": "dev", "region": "", "eventpattern": `{"source":["orders"]}`, "var": []string{"stage=dev", "region=eu-north-1"},
+				"timeout": int64(30), "inputevent": "{}", "expect": []string{}},
+		},
+		{
+			name:    "suite",
+			project: testProjectConfig,
+			args:    []string{"ci", "--suite", "order-paid", "--timeout", "5"},
+			want: map[string]any{"profile": "dev", "region": "", "eventpattern": `{"source":["orders"]}`, "var": []string{"stage=dev", "region=eu-north-1"},
+				"timeout": int64(5), "inputevent": "file://testdata/order_paid.json", "expect": []string{`{"detail-type":["order.paid"]}`, `{"detail-type":["order.shipped"]}`}},
+		},
+		{
+			name:    "preset overrides the suite preset",
+			project: testProjectConfig,
+			args:    []string{"--preset", "orders-prod", "ci", "--suite", "order-paid"},
+			want: map[string]any{"profile": "prod", "region": "", "eventpattern": "{}", "var": []string{},
+				"timeout": int64(12), "inputevent": "file://testdata/order_paid.json", "expect": []string{`{"detail-type":["order.paid"]}`, `{"detail-type":["order.shipped"]}`}},
+		},
+		{
+			name:    "repository presets replace the home ones",
+			project: testProjectConfig,
+			home:    testHomeConfig,
+			args:    []string{"--preset", "orders-dev"},
+			want:    map[string]any{"profile": "dev", "region": "", "eventpattern": `{"source":["orders"]}`, "var": []string{"stage=dev", "region=eu-north-1"}},
+		},
+		{
+			name:    "home preset",
+			project: testProjectConfig,
+			home:    testHomeConfig,
+			args:    []string{"--preset", "personal"},
+			want:    map[string]any{"profile": "", "region": "eu-west-1", "eventpattern": "{}", "var": []string{}},
+		},
+		{
+			name:    "preset not found",
+			project: testProjectConfig,
+			args:    []string{"--preset", "orders"},
+			err:     configFile + ", choose one of: orders-dev, orders-prod",
+		},
+		{
+			name:    "suite not found",
+			project: testProjectConfig,
+			args:    []string{"ci", "--suite", "order-refunded"},
+			err:     configFile + ", choose one of: order-paid, typo",
+		},
+		{
+			name:    "unknown flag",
+			project: testProjectConfig,
+			args:    []string{"ci", "--suite", "typo"},
+			err:     "unknown flag timeuot in suite typo",
+		},
+		{
+			name: "no config file",
+			args: []string{"--preset", "orders-dev"},
+			err:  "no " + configFile + " found in the repository or home directory",
+		},
+		{
+			name:    "invalid config file",
+			project: "presets: [orders-dev]",
+			args:    []string{"--preset", "orders-dev"},
+			err:     "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.project, tt.home)
+
+			got := map[string]any{}
+			err := configTestApp(got).Run(context.Background(), append([]string{namespace}, tt.args...))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_repoConfigPath(t *testing.T) {
+	// a config file above the repository root is ignored
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, configFile), []byte("presets: {}"), 0o644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "repo", ".git"), 0o755))
+	t.Chdir(filepath.Join(dir, "repo"))
+
+	_, ok := repoConfigPath()
+	assert.False(t, ok)
+
+	t.Chdir(dir)
+	p, ok := repoConfigPath()
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, configFile), p)
+}
@@ -1,29 +1,199 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"os"
-	"path"
 	"strings"
 
-	"gopkg.in/yaml.v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
-type samTemplate struct {
-	Resources map[string]struct {
-		Type       string `yaml:"Type"`
-		Properties struct {
-			FunctionName string `yaml:"FunctionName"`
-			Events       map[string]struct {
-				Type       string `yaml:"Type"`
-				Properties struct {
-					EventBusName string `yaml:"EventBusName,omitempty"`
-					InputPath    string `yaml:"InputPath,omitempty"`
-					Pattern      any    `yaml:"Pattern,omitempty"`
-				} `yaml:"Properties"`
-			} `yaml:"Events"`
-		} `yaml:"Properties"`
-	} `yaml:"Resources"`
+// stdin is read at most once, by the first source using it.
+var (
+	stdin     io.Reader = os.Stdin
+	stdinRead bool
+)
+
+// describeRuleAPI resolves the 'rule://' source.
+type describeRuleAPI interface {
+	DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error)
+}
+
+// callerIdentityAPI resolves the AWS::AccountId pseudo parameter of templates.
+type callerIdentityAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// dataSources holds what the event pattern sources need besides the source itself.
+type dataSources struct {
+	rules      describeRuleAPI
+	identity   callerIdentityAPI
+	region     string
+	parameters map[string]string // --parameter-overrides
+	options    map[string]string // --var
+
+	// loadConfig sets rules, identity and region on first use, local sources don't need AWS
+	loadConfig func(context.Context) (aws.Config, error)
+	account    string
+}
+
+func newDataSources(loadConfig func(context.Context) (aws.Config, error), parameters, options map[string]string) *dataSources {
+	return &dataSources{
+		loadConfig: loadConfig,
+		parameters: parameters,
+		options:    options,
+	}
+}
+
+// connect loads the AWS config, if not done yet, for the sources calling AWS or reading its region.
+func (d *dataSources) connect(ctx context.Context) error {
+	if d.loadConfig == nil {
+		return nil
+	}
+
+	cfg, err := d.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	d.loadConfig = nil
+	d.rules = eventbridge.NewFromConfig(cfg)
+	d.identity = sts.NewFromConfig(cfg)
+	d.region = cfg.Region
+	return nil
+}
+
+// accountID returns the account of the AWS credentials, looked up on first use.
+func (d *dataSources) accountID(ctx context.Context) (string, error) {
+	if d.account != "" {
+		return d.account, nil
+	}
+	if err := d.connect(ctx); err != nil {
+		return "", fmt.Errorf("AWS::AccountId: %w", err)
+	}
+	if d.identity == nil {
+		return "", errors.New("AWS::AccountId can't be resolved, set it with --parameter-overrides AWS::AccountId=<value>")
+	}
+
+	res, err := d.identity.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("AWS::AccountId: %w", err)
+	}
+	d.account = aws.ToString(res.Account)
+	return d.account, nil
+}
+
+// resolveEventPattern reads an event pattern from the cli, stdin, a 'file://', 'sam://', 'cfn://', 'cdk://', 'tf://',
+// 'sls://', 'asyncapi://' or 'rule://' source.
+// eventBus is the bus the pattern is deployed on, when the source defines it.
+func resolveEventPattern(ctx context.Context, src *dataSources, eventPattern string) (pattern, eventBus string, err error) {
+	switch {
+	case isStdin(eventPattern):
+		pattern, err = dataFromStdin()
+
+	case strings.HasPrefix(eventPattern, "file://"):
+		pattern, err = dataFromFile(eventPattern)
+
+	case strings.HasPrefix(eventPattern, "sam://"):
+		return dataFromSAM(ctx, src, eventPattern)
+
+	case strings.HasPrefix(eventPattern, "cfn://"):
+		return dataFromCFN(ctx, src, eventPattern)
+
+	case strings.HasPrefix(eventPattern, "cdk://"):
+		return dataFromCDK(ctx, src, eventPattern)
+
+	case strings.HasPrefix(eventPattern, "tf://"):
+		return dataFromTerraform(eventPattern)
+
+	case strings.HasPrefix(eventPattern, "sls://"):
+		return dataFromServerless(src, eventPattern)
+
+	case strings.HasPrefix(eventPattern, "asyncapi://"):
+		return dataFromAsyncAPI(eventPattern)
+
+	case strings.HasPrefix(eventPattern, "rule://"):
+		if err := src.connect(ctx); err != nil {
+			return "", "", err
+		}
+		return dataFromRule(ctx, src.rules, eventPattern)
+
+	default:
+		pattern = eventPattern
+	}
+
+	return pattern, "", err
+}
+
+// resolveInputEvent reads an input event from the cli, stdin or a 'file://' source, or generates it from an
+// 'asyncapi://' message.
+func resolveInputEvent(event string) (string, error) {
+	switch {
+	case isStdin(event):
+		return dataFromStdin()
+
+	case strings.HasPrefix(event, "file://"):
+		return dataFromFile(event)
+
+	case strings.HasPrefix(event, "asyncapi://"):
+		return eventFromAsyncAPI(event)
+	}
+
+	return event, nil
+}
+
+// isStdin reports whether a source is '-' or 'stdin://'.
+func isStdin(source string) bool {
+	return source == "-" || strings.HasPrefix(source, "stdin://")
+}
+
+// - or stdin://
+func dataFromStdin() (string, error) {
+	if stdinRead {
+		return "", errors.New("stdin can only be used by one source")
+	}
+	stdinRead = true
+
+	content, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return "", errors.New("stdin is empty")
+	}
+
+	return string(content), nil
+}
+
+// readEventStream calls fn with every event of an NDJSON, or concatenated JSON, stream,
+// once its template is rendered.
+func readEventStream(r io.Reader, vars map[string]string, fn func(n int, event string) error) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("invalid input event %d: %w", n, err)}
+		}
+
+		event, err := renderTemplate(string(raw), vars)
+		if err != nil {
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("input event %d: %w", n, err)}
+		}
+
+		if err := fn(n, event); err != nil {
+			return err
+		}
+	}
 }
 
 // file://eventpattern.json
@@ -36,33 +206,72 @@ func dataFromFile(filepath string) (string, error) {
 	return string(content), nil
 }
 
-// sam://template.yaml/FunctionName
-func dataFromSAM(sampath string) (string, error) {
-	function := path.Base(sampath)
-	template := strings.TrimSuffix(strings.TrimPrefix(sampath, "sam://"), "/"+function)
+// rule://bus/RuleName, the bus defaults to 'default' when omitted
+func dataFromRule(ctx context.Context, api describeRuleAPI, rulepath string) (string, string, error) {
+	ref := strings.TrimPrefix(rulepath, "rule://")
+	bus, name := "default", ref
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		bus, name = ref[:i], ref[i+1:]
+	}
+	if bus == "" || name == "" {
+		return "", "", fmt.Errorf("invalid rule source %q, expected rule://<bus>/<rule-name>", rulepath)
+	}
 
-	content, err := os.ReadFile(template)
+	res, err := api.DescribeRule(ctx, &eventbridge.DescribeRuleInput{
+		Name:         aws.String(name),
+		EventBusName: aws.String(bus),
+	})
 	if err != nil {
-		return "", err
+		return "", "", fmt.Errorf("describe rule %s on bus %s: %w", name, bus, err)
 	}
 
-	// unmarshal SAM template
-	b := &samTemplate{}
-	if err := yaml.Unmarshal(content, b); err != nil {
-		return "", err
+	if res.EventPattern == nil {
+		return "", "", fmt.Errorf("rule %s on bus %s has no event pattern, schedule rules can't be listened to", name, bus)
+	}
+	if res.ManagedBy != nil {
+		log.Printf("rule %s is managed by %s", name, *res.ManagedBy)
+	}
+	if res.State != types.RuleStateEnabled {
+		log.Printf("rule %s is %s", name, res.State)
 	}
 
-	// find EventBridgeRule and marshal to JSON
-	var pattern []byte
-	for _, e := range b.Resources[function].Properties.Events {
-		if e.Type == "EventBridgeRule" {
-			if pattern, err = json.Marshal(convertMap(e.Properties.Pattern)); err != nil {
-				return "", err
-			}
-		}
+	return *res.EventPattern, bus, nil
+}
+
+// sam://template.yaml/FunctionName, or sam://template.yaml/FunctionName/EventName
+func dataFromSAM(ctx context.Context, src *dataSources, sampath string) (string, string, error) {
+	template, refs, err := splitTemplatePath(strings.TrimPrefix(sampath, "sam://"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(refs) > 2 {
+		return "", "", fmt.Errorf("invalid sam source %q, expected sam://<template>/<function>[/<event>]", sampath)
+	}
+
+	t, err := loadTemplate(template)
+	if err != nil {
+		return "", "", err
+	}
+
+	function, eventName := refs[0], ""
+	if len(refs) > 1 {
+		eventName = refs[1]
+	}
+	res, ok := t.Resources[function]
+	if !ok {
+		return "", "", fmt.Errorf("function %s not found in %s", function, template)
+	}
+	if res.Type != "AWS::Serverless::Function" && res.Type != "AWS::Serverless::StateMachine" {
+		return "", "", fmt.Errorf("resource %s is of type %s, expected AWS::Serverless::Function or AWS::Serverless::StateMachine", function, res.Type)
+	}
+
+	// find the EventBridgeRule event and marshal to JSON
+	e, err := selectEventBridgeEvent(function, res.Properties.Events, eventName)
+	if err != nil {
+		return "", "", err
 	}
 
-	return string(pattern), nil
+	return newCFNResolver(ctx, src, t).pattern(e.Properties.Pattern, e.Properties.EventBusName)
 }
 
 // convert map[any]any to map[string]any
@@ -4,10 +4,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -34,6 +40,174 @@ func Test_dataFromFile(t *testing.T) {
 	})
 }
 
+func Test_resolveEventPattern(t *testing.T) {
+	t.Run("inline pattern is returned as is", func(t *testing.T) {
+		got, _, err := resolveEventPattern(context.Background(), &dataSources{}, `{"source":["beta"]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"source":["beta"]}`, got)
+	})
+
+	t.Run("file source", func(t *testing.T) {
+		got, _, err := resolveEventPattern(context.Background(), &dataSources{}, "file://testdata/eventpattern.json")
+		assert.NoError(t, err)
+		assert.Contains(t, got, "beta")
+	})
+
+	t.Run("sam source", func(t *testing.T) {
+		got, _, err := resolveEventPattern(context.Background(), &dataSources{}, "sam://testdata/template.yaml/BetaFunction")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"source":["beta"],"detail":{"channel":["web"]}}`, got)
+	})
+}
+
+type mockDescribeRuleAPI struct {
+	rules map[string]*eventbridge.DescribeRuleOutput // by bus/name
+}
+
+func (m *mockDescribeRuleAPI) DescribeRule(ctx context.Context, params *eventbridge.DescribeRuleInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeRuleOutput, error) {
+	rule, ok := m.rules[*params.EventBusName+"/"+*params.Name]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Rule " + *params.Name + " does not exist.")}
+	}
+	return rule, nil
+}
+
+func Test_dataFromRule(t *testing.T) {
+	api := &mockDescribeRuleAPI{rules: map[string]*eventbridge.DescribeRuleOutput{
+		"fishnchips-eventbus/BetaRule": {
+			EventPattern: aws.String(`{"source":["beta"]}`),
+			State:        types.RuleStateEnabled,
+		},
+		"default/ManagedRule": {
+			EventPattern: aws.String(`{"source":["aws.ec2"]}`),
+			ManagedBy:    aws.String("some.service.amazonaws.com"),
+			State:        types.RuleStateDisabled,
+		},
+		"default/ScheduleRule": {
+			ScheduleExpression: aws.String("rate(5 minutes)"),
+			State:              types.RuleStateEnabled,
+		},
+	}}
+	ctx := context.Background()
+
+	t.Run("pattern and bus of the deployed rule", func(t *testing.T) {
+		pattern, bus, err := resolveEventPattern(ctx, &dataSources{rules: api}, "rule://fishnchips-eventbus/BetaRule")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"source":["beta"]}`, pattern)
+		assert.Equal(t, "fishnchips-eventbus", bus)
+	})
+
+	t.Run("bus defaults to default", func(t *testing.T) {
+		pattern, bus, err := dataFromRule(ctx, api, "rule://ManagedRule")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"source":["aws.ec2"]}`, pattern)
+		assert.Equal(t, "default", bus)
+	})
+
+	t.Run("schedule rule returns error", func(t *testing.T) {
+		_, _, err := dataFromRule(ctx, api, "rule://default/ScheduleRule")
+		assert.ErrorContains(t, err, "has no event pattern")
+	})
+
+	t.Run("missing rule returns error", func(t *testing.T) {
+		_, _, err := dataFromRule(ctx, api, "rule://default/MissingRule")
+		assert.ErrorContains(t, err, "describe rule MissingRule on bus default")
+	})
+
+	t.Run("invalid source returns error", func(t *testing.T) {
+		_, _, err := dataFromRule(ctx, api, "rule://default/")
+		assert.ErrorContains(t, err, "invalid rule source")
+	})
+}
+
+func Test_resolveInputEvent(t *testing.T) {
+	got, err := resolveInputEvent("file://testdata/event_ci_success.json")
+	assert.NoError(t, err)
+	assert.Contains(t, got, `"source": "beta"`)
+
+	_, err = resolveInputEvent("file:///nonexistent/event.json")
+	assert.Error(t, err)
+}
+
+// withStdin replaces stdin with s for the duration of the test.
+func withStdin(t *testing.T, s string) {
+	t.Helper()
+	orig := stdin
+	stdin, stdinRead = strings.NewReader(s), false
+	t.Cleanup(func() { stdin, stdinRead = orig, false })
+}
+
+func Test_dataFromStdin(t *testing.T) {
+	t.Run("event pattern from '-'", func(t *testing.T) {
+		withStdin(t, `{"source":["beta"]}`+"\n")
+		got, _, err := resolveEventPattern(context.Background(), &dataSources{}, "-")
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"source":["beta"]}`, got)
+	})
+
+	t.Run("input event from 'stdin://'", func(t *testing.T) {
+		withStdin(t, `{"source":"beta"}`)
+		got, err := resolveInputEvent("stdin://")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"source":"beta"}`, got)
+	})
+
+	t.Run("stdin is read by one source only", func(t *testing.T) {
+		withStdin(t, `{"source":["beta"]}`)
+		_, _, err := resolveEventPattern(context.Background(), &dataSources{}, "-")
+		require.NoError(t, err)
+		_, err = resolveInputEvent("-")
+		assert.EqualError(t, err, "stdin can only be used by one source")
+	})
+
+	t.Run("empty stdin returns error", func(t *testing.T) {
+		withStdin(t, " \n")
+		_, err := resolveInputEvent("-")
+		assert.EqualError(t, err, "stdin is empty")
+	})
+}
+
+func Test_readEventStream(t *testing.T) {
+	collect := func(r string, vars map[string]string) ([]string, error) {
+		var events []string
+		err := readEventStream(strings.NewReader(r), vars, func(n int, event string) error {
+			assert.Equal(t, len(events)+1, n)
+			events = append(events, event)
+			return nil
+		})
+		return events, err
+	}
+
+	t.Run("NDJSON stream", func(t *testing.T) {
+		events, err := collect(`{"source":"a"}`+"\n"+`{"source":"{{.src}}"}`+"\n\n", map[string]string{"src": "b"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{`{"source":"a"}`, `{"source":"b"}`}, events)
+	})
+
+	t.Run("pretty printed events", func(t *testing.T) {
+		events, err := collect("{\n  \"source\": \"a\"\n}\n{\"source\": \"b\"}", nil)
+		assert.NoError(t, err)
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("invalid event stops the stream", func(t *testing.T) {
+		events, err := collect(`{"source":"a"}`+"\n"+`{"source":`, nil)
+		assert.ErrorContains(t, err, "invalid input event 2")
+		assert.Equal(t, exitInvalidInput, exitCodeOf(err))
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		calls := 0
+		err := readEventStream(strings.NewReader(`{}{}{}`), nil, func(int, string) error {
+			calls++
+			return errors.New("boom")
+		})
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, 1, calls)
+	})
+}
+
 func Test_dataFromSAM(t *testing.T) {
 	const samYAML = `
 Resources:
@@ -59,14 +233,15 @@ Resources:
 		err := os.WriteFile(tmplPath, []byte(samYAML), 0644)
 		require.NoError(t, err)
 
-		got, err := dataFromSAM("sam://" + tmplPath + "/MyFunction")
+		got, bus, err := dataFromSAM(context.Background(), &dataSources{}, "sam://"+tmplPath+"/MyFunction")
 		assert.NoError(t, err)
 		assert.Contains(t, got, "aws.ec2")
 		assert.Contains(t, got, "EC2 Instance State-change Notification")
+		assert.Equal(t, "default", bus)
 	})
 
 	t.Run("missing template file returns error", func(t *testing.T) {
-		_, err := dataFromSAM("sam:///nonexistent/template.yaml/MyFunction")
+		_, _, err := dataFromSAM(context.Background(), &dataSources{}, "sam:///nonexistent/template.yaml/MyFunction")
 		assert.Error(t, err)
 	})
 
@@ -76,9 +251,67 @@ Resources:
 		err := os.WriteFile(tmplPath, []byte("key: [unclosed"), 0644)
 		require.NoError(t, err)
 
-		_, err = dataFromSAM("sam://" + tmplPath + "/MyFunction")
+		_, _, err = dataFromSAM(context.Background(), &dataSources{}, "sam://"+tmplPath+"/MyFunction")
 		assert.Error(t, err)
 	})
+
+	tests := []struct {
+		name    string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "named event",
+			source:  "sam://testdata/template_events.yaml/OrdersFunction/Refunded",
+			pattern: `{"source":["orders"],"detail-type":["order.refunded"]}`,
+			bus:     "orders-eventbus",
+		},
+		{
+			name:    "event without bus",
+			source:  "sam://testdata/template_events.yaml/OrdersFunction/Paid",
+			pattern: `{"source":["orders"],"detail-type":["order.paid"]}`,
+		},
+		{
+			name:   "several events list the choices",
+			source: "sam://testdata/template_events.yaml/OrdersFunction",
+			err:    "OrdersFunction has 2 EventBridgeRule events, choose one of: Paid, Refunded",
+		},
+		{
+			name:   "event of another type",
+			source: "sam://testdata/template_events.yaml/OrdersFunction/Api",
+			err:    "OrdersFunction has no EventBridgeRule event Api, choose one of: Paid, Refunded",
+		},
+		{
+			name:   "function without EventBridge events",
+			source: "sam://testdata/template_events.yaml/ApiFunction",
+			err:    "ApiFunction has no EventBridgeRule event",
+		},
+		{
+			name:   "missing function",
+			source: "sam://testdata/template_events.yaml/MissingFunction",
+			err:    "function MissingFunction not found",
+		},
+		{
+			name:   "not a SAM resource",
+			source: "sam://testdata/template_events.yaml/OrdersQueue",
+			err:    "resource OrdersQueue is of type AWS::SQS::Queue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := resolveEventPattern(context.Background(), &dataSources{}, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
 }
 
 func Test_convertMap(t *testing.T) {
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v3"
+)
+
+// requiredActions are the IAM actions eventbridge-cli calls while running, 'rule://' patterns included.
+// DeleteMessageBatch is authorized by sqs:DeleteMessage.
+var requiredActions = []string{
+	"events:PutRule",
+	"events:PutTargets",
+	"events:RemoveTargets",
+	"events:DeleteRule",
+	"events:PutEvents",
+	"events:ListRules",
+	"events:DescribeRule",
+	"events:TestEventPattern",
+	"sqs:CreateQueue",
+	"sqs:DeleteQueue",
+	"sqs:ReceiveMessage",
+	"sqs:DeleteMessage",
+	"sqs:GetQueueAttributes",
+}
+
+type checkStatus int
+
+const (
+	checkPass checkStatus = iota
+	checkFail
+	checkSkip
+)
+
+type doctorCheck struct {
+	name   string
+	status checkStatus
+	detail string
+	hint   string
+}
+
+type doctorSTSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+type doctorIAMAPI interface {
+	GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+type doctorEventbridgeAPI interface {
+	DescribeEventBus(ctx context.Context, params *eventbridge.DescribeEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeEventBusOutput, error)
+}
+
+type doctorSQSAPI interface {
+	ListQueues(ctx context.Context, params *sqs.ListQueuesInput, optFns ...func(*sqs.Options)) (*sqs.ListQueuesOutput, error)
+}
+
+// doctor runs read-only preflight checks against the AWS account.
+type doctor struct {
+	sts         doctorSTSAPI
+	iam         doctorIAMAPI
+	eventbridge doctorEventbridgeAPI
+	sqs         doctorSQSAPI
+
+	credentials  aws.CredentialsProvider
+	region       string
+	eventBusName string
+}
+
+func newDoctor(cfg aws.Config, eventBusName string) *doctor {
+	return &doctor{
+		sts:          sts.NewFromConfig(cfg),
+		iam:          iam.NewFromConfig(cfg),
+		eventbridge:  eventbridge.NewFromConfig(cfg),
+		sqs:          sqs.NewFromConfig(cfg),
+		credentials:  cfg.Credentials,
+		region:       cfg.Region,
+		eventBusName: eventBusName,
+	}
+}
+
+func runDoctor(ctx context.Context, cmd *cli.Command) error {
+	var checks []doctorCheck
+
+	awsCfg, err := loadAWSConfig(ctx, cmd.String("profile"), cmd.String("region"))
+	if err != nil {
+		checks = []doctorCheck{{
+			name:   "AWS config loads",
+			status: checkFail,
+			detail: err.Error(),
+			hint:   "check --profile / AWS_PROFILE and ~/.aws/config",
+		}}
+	} else {
+		checks = newDoctor(awsCfg, cmd.String("eventbusname")).run(ctx)
+	}
+
+	failed := 0
+	for _, c := range checks {
+		switch c.status {
+		case checkPass:
+			log.Printf("%s %s", color.GreenString("✔"), c.name)
+		case checkSkip:
+			log.Printf("%s %s", color.YellowString("-"), c.name)
+		case checkFail:
+			failed++
+			log.Printf("%s %s", color.RedString("✘"), c.name)
+		}
+		if c.detail != "" {
+			log.Printf("    %s", c.detail)
+		}
+		if c.status == checkFail && c.hint != "" {
+			log.Printf("    hint: %s", c.hint)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("doctor: %d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// run executes every check in order. Checks depending on a failed one are skipped.
+func (d *doctor) run(ctx context.Context) []doctorCheck {
+	var checks []doctorCheck
+	skipAll := func(reason string, names ...string) []doctorCheck {
+		for _, n := range names {
+			checks = append(checks, doctorCheck{name: n, status: checkSkip, detail: reason})
+		}
+		return checks
+	}
+
+	const (
+		nameCredentials = "credentials resolve"
+		nameRegion      = "region is set"
+		nameIdentity    = "caller identity"
+		nameBus         = "event bus exists"
+		namePermissions = "caller can perform required actions"
+		nameSQS         = "SQS is reachable"
+		nameBusPolicy   = "bus policy allows events:PutEvents"
+	)
+
+	// credentials
+	if d.credentials == nil {
+		checks = append(checks, doctorCheck{name: nameCredentials, status: checkFail, detail: "no credentials provider configured", hint: "set AWS_PROFILE or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY"})
+		return skipAll("skipped: no credentials", nameRegion, nameIdentity, nameBus, namePermissions, nameSQS, nameBusPolicy)
+	}
+	if _, err := d.credentials.Retrieve(ctx); err != nil {
+		checks = append(checks, doctorCheck{name: nameCredentials, status: checkFail, detail: err.Error(), hint: "refresh your session (ie. aws sso login) or set AWS_PROFILE / AWS_ACCESS_KEY_ID"})
+		return skipAll("skipped: no credentials", nameRegion, nameIdentity, nameBus, namePermissions, nameSQS, nameBusPolicy)
+	}
+	checks = append(checks, doctorCheck{name: nameCredentials, status: checkPass})
+
+	// region
+	if d.region == "" {
+		checks = append(checks, doctorCheck{name: nameRegion, status: checkFail, hint: "use --region or set AWS_REGION / AWS_DEFAULT_REGION"})
+		return skipAll("skipped: no region", nameIdentity, nameBus, namePermissions, nameSQS, nameBusPolicy)
+	}
+	checks = append(checks, doctorCheck{name: nameRegion, status: checkPass, detail: d.region})
+
+	// caller identity
+	identity, err := d.sts.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		checks = append(checks, doctorCheck{name: nameIdentity, status: checkFail, detail: err.Error(), hint: "credentials were rejected by STS, check they are valid for this partition"})
+		return skipAll("skipped: unknown caller", nameBus, namePermissions, nameSQS, nameBusPolicy)
+	}
+	callerArn := aws.ToString(identity.Arn)
+	checks = append(checks, doctorCheck{name: nameIdentity, status: checkPass, detail: callerArn})
+
+	// event bus
+	bus, busErr := d.eventbridge.DescribeEventBus(ctx, &eventbridge.DescribeEventBusInput{
+		Name: aws.String(d.eventBusName),
+	})
+	if busErr != nil {
+		checks = append(checks, doctorCheck{name: nameBus, status: checkFail, detail: busErr.Error(), hint: fmt.Sprintf("check --eventbusname [%s] and --region [%s]", d.eventBusName, d.region)})
+	} else {
+		checks = append(checks, doctorCheck{name: nameBus, status: checkPass, detail: aws.ToString(bus.Arn)})
+	}
+
+	// IAM permissions
+	principalArn, ok := d.principalArn(ctx, callerArn)
+	if !ok {
+		checks = skipAll("skipped: policy simulation is not supported for "+callerArn, namePermissions)
+	} else {
+		checks = append(checks, d.simulate(ctx, namePermissions, principalArn, requiredActions, nil, nil))
+	}
+
+	// SQS
+	if _, err := d.sqs.ListQueues(ctx, &sqs.ListQueuesInput{
+		QueueNamePrefix: aws.String(namespace),
+		MaxResults:      aws.Int32(1),
+	}); err != nil {
+		checks = append(checks, doctorCheck{name: nameSQS, status: checkFail, detail: err.Error(), hint: "check network access to the SQS endpoint and sqs:ListQueues permission"})
+	} else {
+		checks = append(checks, doctorCheck{name: nameSQS, status: checkPass})
+	}
+
+	// bus resource policy
+	switch {
+	case busErr != nil:
+		checks = skipAll("skipped: event bus not found", nameBusPolicy)
+	case !ok:
+		checks = skipAll("skipped: policy simulation is not supported for "+callerArn, nameBusPolicy)
+	default:
+		checks = append(checks, d.simulate(ctx, nameBusPolicy, principalArn, []string{"events:PutEvents"}, bus.Arn, bus.Policy))
+	}
+
+	return checks
+}
+
+// simulate runs iam:SimulatePrincipalPolicy and fails the check if any action is denied.
+func (d *doctor) simulate(ctx context.Context, name, principalArn string, actions []string, resourceArn, resourcePolicy *string) doctorCheck {
+	input := &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(principalArn),
+		ActionNames:     actions,
+		ResourcePolicy:  resourcePolicy,
+	}
+	if resourceArn != nil {
+		input.ResourceArns = []string{*resourceArn}
+	}
+
+	var denied []string
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(d.iam, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return doctorCheck{name: name, status: checkFail, detail: err.Error(), hint: "grant iam:SimulatePrincipalPolicy to run this check"}
+		}
+		for _, r := range page.EvaluationResults {
+			if r.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+				denied = append(denied, fmt.Sprintf("%s (%s)", aws.ToString(r.EvalActionName), r.EvalDecision))
+			}
+		}
+	}
+
+	if len(denied) > 0 {
+		hint := "attach a policy allowing these actions to " + principalArn
+		if resourcePolicy != nil {
+			hint = "allow events:PutEvents for " + principalArn + " in the event bus resource policy"
+		}
+		return doctorCheck{name: name, status: checkFail, detail: "denied: " + strings.Join(denied, ", "), hint: hint}
+	}
+	return doctorCheck{name: name, status: checkPass}
+}
+
+// principalArn maps the STS caller ARN to an IAM principal usable by SimulatePrincipalPolicy.
+// Assumed roles are resolved to their role ARN, including the path when iam:GetRole is allowed.
+func (d *doctor) principalArn(ctx context.Context, callerArn string) (string, bool) {
+	// arn:partition:service::account:resource
+	parts := strings.SplitN(callerArn, ":", 6)
+	if len(parts) != 6 {
+		return "", false
+	}
+	partition, service, account, resource := parts[1], parts[2], parts[4], parts[5]
+
+	switch {
+	case service == "iam" && strings.HasPrefix(resource, "user/"):
+		return callerArn, true
+
+	case service == "sts" && strings.HasPrefix(resource, "assumed-role/"):
+		roleName := strings.Split(strings.TrimPrefix(resource, "assumed-role/"), "/")[0]
+		if resp, err := d.iam.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(roleName)}); err == nil && resp.Role != nil {
+			return aws.ToString(resp.Role.Arn), true
+		}
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, account, roleName), true
+	}
+
+	return "", false
+}
@@ -0,0 +1,215 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDoctorAPI struct {
+	callerArn string
+	roleArn   string
+	denied    map[string]bool
+
+	busErr error
+	sqsErr error
+
+	simulated []*iam.SimulatePrincipalPolicyInput
+}
+
+func (m *mockDoctorAPI) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(m.callerArn)}, nil
+}
+
+func (m *mockDoctorAPI) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if m.roleArn == "" {
+		return nil, errors.New("AccessDenied")
+	}
+	return &iam.GetRoleOutput{Role: &iamtypes.Role{Arn: aws.String(m.roleArn)}}, nil
+}
+
+func (m *mockDoctorAPI) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	m.simulated = append(m.simulated, params)
+	out := &iam.SimulatePrincipalPolicyOutput{}
+	for _, a := range params.ActionNames {
+		decision := iamtypes.PolicyEvaluationDecisionTypeAllowed
+		if m.denied[a] {
+			decision = iamtypes.PolicyEvaluationDecisionTypeImplicitDeny
+		}
+		out.EvaluationResults = append(out.EvaluationResults, iamtypes.EvaluationResult{
+			EvalActionName: aws.String(a),
+			EvalDecision:   decision,
+		})
+	}
+	return out, nil
+}
+
+func (m *mockDoctorAPI) DescribeEventBus(ctx context.Context, params *eventbridge.DescribeEventBusInput, optFns ...func(*eventbridge.Options)) (*eventbridge.DescribeEventBusOutput, error) {
+	if m.busErr != nil {
+		return nil, m.busErr
+	}
+	return &eventbridge.DescribeEventBusOutput{
+		Arn:    aws.String("arn:aws:events:eu-north-1:1234567890:event-bus/" + *params.Name),
+		Policy: aws.String(`{"Version":"2012-10-17","Statement":[]}`),
+	}, nil
+}
+
+func (m *mockDoctorAPI) ListQueues(ctx context.Context, params *sqs.ListQueuesInput, optFns ...func(*sqs.Options)) (*sqs.ListQueuesOutput, error) {
+	return &sqs.ListQueuesOutput{}, m.sqsErr
+}
+
+func newMockDoctor(m *mockDoctorAPI, creds aws.CredentialsProvider, region string) *doctor {
+	return &doctor{
+		sts:          m,
+		iam:          m,
+		eventbridge:  m,
+		sqs:          m,
+		credentials:  creds,
+		region:       region,
+		eventBusName: "default",
+	}
+}
+
+func statuses(checks []doctorCheck) []checkStatus {
+	s := make([]checkStatus, 0, len(checks))
+	for _, c := range checks {
+		s = append(s, c.status)
+	}
+	return s
+}
+
+func Test_doctor(t *testing.T) {
+	creds := aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	}))
+	expiredCreds := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("token expired")
+	})
+
+	t.Run("all checks pass", func(t *testing.T) {
+		m := &mockDoctorAPI{callerArn: "arn:aws:iam::1234567890:user/alice"}
+		checks := newMockDoctor(m, creds, "eu-north-1").run(context.Background())
+
+		assert.Len(t, checks, 7)
+		for _, c := range checks {
+			assert.Equal(t, checkPass, c.status, c.name)
+		}
+
+		// bus policy is simulated against the bus ARN
+		assert.Len(t, m.simulated, 2)
+		assert.Equal(t, []string{"arn:aws:events:eu-north-1:1234567890:event-bus/default"}, m.simulated[1].ResourceArns)
+		assert.NotNil(t, m.simulated[1].ResourcePolicy)
+	})
+
+	t.Run("credentials failure skips remaining checks", func(t *testing.T) {
+		checks := newMockDoctor(&mockDoctorAPI{}, expiredCreds, "eu-north-1").run(context.Background())
+
+		assert.Equal(t, []checkStatus{checkFail, checkSkip, checkSkip, checkSkip, checkSkip, checkSkip, checkSkip}, statuses(checks))
+		assert.NotEmpty(t, checks[0].hint)
+	})
+
+	t.Run("missing region fails", func(t *testing.T) {
+		checks := newMockDoctor(&mockDoctorAPI{}, creds, "").run(context.Background())
+
+		assert.Equal(t, checkPass, checks[0].status)
+		assert.Equal(t, checkFail, checks[1].status)
+	})
+
+	t.Run("denied action and missing bus", func(t *testing.T) {
+		m := &mockDoctorAPI{
+			callerArn: "arn:aws:iam::1234567890:user/alice",
+			denied:    map[string]bool{"sqs:CreateQueue": true},
+			busErr:    errors.New("ResourceNotFoundException"),
+		}
+		checks := newMockDoctor(m, creds, "eu-north-1").run(context.Background())
+
+		assert.Equal(t, []checkStatus{checkPass, checkPass, checkPass, checkFail, checkFail, checkPass, checkSkip}, statuses(checks))
+		assert.Contains(t, checks[4].detail, "sqs:CreateQueue")
+	})
+}
+
+func Test_doctorPrincipalArn(t *testing.T) {
+	tests := []struct {
+		name      string
+		callerArn string
+		roleArn   string
+
+		want string
+		ok   bool
+	}{
+		{
+			name:      "IAM user",
+			callerArn: "arn:aws:iam::1234567890:user/alice",
+			want:      "arn:aws:iam::1234567890:user/alice",
+			ok:        true,
+		},
+		{
+			name:      "assumed role resolved with GetRole",
+			callerArn: "arn:aws:sts::1234567890:assumed-role/AWSReservedSSO_Dev_abc/alice",
+			roleArn:   "arn:aws:iam::1234567890:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Dev_abc",
+			want:      "arn:aws:iam::1234567890:role/aws-reserved/sso.amazonaws.com/AWSReservedSSO_Dev_abc",
+			ok:        true,
+		},
+		{
+			name:      "assumed role without GetRole",
+			callerArn: "arn:aws-cn:sts::1234567890:assumed-role/ci/session",
+			want:      "arn:aws-cn:iam::1234567890:role/ci",
+			ok:        true,
+		},
+		{
+			name:      "root is not supported",
+			callerArn: "arn:aws:iam::1234567890:root",
+			ok:        false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newMockDoctor(&mockDoctorAPI{roleArn: test.roleArn}, nil, "")
+
+			got, ok := d.principalArn(context.Background(), test.callerArn)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func Test_requiredActions(t *testing.T) {
+	// the SQS and DescribeRule calls are made through interfaces, every method needs its action
+	for _, api := range []struct {
+		service string
+		typ     reflect.Type
+	}{
+		{"sqs", reflect.TypeFor[sqsClientAPI]()},
+		{"events", reflect.TypeFor[describeRuleAPI]()},
+	} {
+		for i := range api.typ.NumMethod() {
+			action := api.service + ":" + strings.TrimSuffix(api.typ.Method(i).Name, "Batch")
+			assert.Contains(t, requiredActions, action)
+		}
+	}
+
+	// the EventBridge client is called directly by eventbridge.go
+	src, err := os.ReadFile("eventbridge.go")
+	assert.NoError(t, err)
+	calls := regexp.MustCompile(`\.client\.([A-Z]\w*)\(`).FindAllStringSubmatch(string(src), -1)
+	assert.NotEmpty(t, calls)
+	for _, call := range calls {
+		assert.Contains(t, requiredActions, "events:"+call[1])
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 )
 
 type eventbridgeClient struct {
@@ -29,27 +32,46 @@ func newEventbridgeClient(cfg aws.Config, eventBusName, ruleName string) *eventb
 }
 
 func (e *eventbridgeClient) testEventPattern(ctx context.Context, inputEvent, eventRule string) error {
-	// list eventbridge rules filtered by prefix
+	rules, err := e.listRules(ctx, eventRule)
+	if err != nil {
+		return err
+	}
+
+	return e.testRules(ctx, rules, inputEvent)
+}
+
+// listRules lists the bus rules with an event pattern, filtered by name prefix.
+func (e *eventbridgeClient) listRules(ctx context.Context, prefix string) ([]types.Rule, error) {
 	resp, err := e.client.ListRules(ctx, &eventbridge.ListRulesInput{
 		EventBusName: aws.String(e.eventBusName),
-		NamePrefix:   aws.String(eventRule),
+		NamePrefix:   aws.String(prefix),
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(resp.Rules) < 1 {
-		log.Printf("no event rule with prefix: %s", eventRule)
-		return nil
+		log.Printf("no event rule with prefix: %s", prefix)
 	}
 
-	log.Printf("event rules matching the event:")
+	var rules []types.Rule
 	for _, r := range resp.Rules {
 		// skip schedule rules since EventPattern is nil
-		if r.EventPattern == nil {
-			continue
+		if r.EventPattern != nil {
+			rules = append(rules, r)
 		}
+	}
+	return rules, nil
+}
 
+// testRules logs which of the rules match inputEvent.
+func (e *eventbridgeClient) testRules(ctx context.Context, rules []types.Rule, inputEvent string) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	log.Printf("event rules matching the event:")
+	for _, r := range rules {
 		res, err := e.client.TestEventPattern(ctx, &eventbridge.TestEventPatternInput{
 			Event:        aws.String(inputEvent),
 			EventPattern: r.EventPattern,
@@ -92,16 +114,135 @@ func (e *eventbridgeClient) deleteRule(ctx context.Context) error {
 	return err
 }
 
-func (e *eventbridgeClient) putEvent(ctx context.Context, event string) error {
-	log.Printf("putting event: %s", event)
-	ev := struct {
-		Source     string `json:"source"`
-		Detail     string `json:"detail"`
-		DetailType string `json:"detail-type"`
-	}{}
+// inputEvent is the event accepted by --inputevent, mapped to a PutEvents entry.
+type inputEvent struct {
+	Source     string `json:"source"`
+	Detail     string `json:"detail"`
+	DetailType string `json:"detail-type"`
+}
+
+func parseInputEvent(event string) (inputEvent, error) {
+	ev := inputEvent{}
 	err := json.Unmarshal([]byte(event), &ev)
+	return ev, err
+}
+
+// parseInputEvents splits a JSON array of input events, sent in order. Anything else is a single event.
+func parseInputEvents(s string) ([]string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(s), "[") {
+		return []string{s}, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		return nil, fmt.Errorf("invalid input events: %w", err)
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("invalid input events: empty list")
+	}
+
+	events := make([]string, 0, len(raw))
+	for _, r := range raw {
+		events = append(events, string(r))
+	}
+	return events, nil
+}
+
+// deliveredEvent returns the event as EventBridge delivers it to targets.
+func deliveredEvent(event, account, region string) (string, error) {
+	ev, err := parseInputEvent(event)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	detail := json.RawMessage("{}")
+	if ev.Detail != "" {
+		if !json.Valid([]byte(ev.Detail)) {
+			return "", fmt.Errorf("detail is not valid JSON: %s", ev.Detail)
+		}
+		detail = json.RawMessage(ev.Detail)
+	}
+
+	b, err := json.Marshal(struct {
+		Version    string          `json:"version"`
+		ID         string          `json:"id"`
+		DetailType string          `json:"detail-type"`
+		Source     string          `json:"source"`
+		Account    string          `json:"account"`
+		Time       string          `json:"time"`
+		Region     string          `json:"region"`
+		Resources  []string        `json:"resources"`
+		Detail     json.RawMessage `json:"detail"`
+	}{
+		Version:    "0",
+		ID:         uuid.New().String(),
+		DetailType: ev.DetailType,
+		Source:     ev.Source,
+		Account:    account,
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Region:     region,
+		Resources:  []string{},
+		Detail:     detail,
+	})
+	return string(b), err
+}
+
+// matchesPattern evaluates a delivered event against pattern with the TestEventPattern API.
+func (e *eventbridgeClient) matchesPattern(ctx context.Context, event, pattern string) (bool, error) {
+	res, err := e.client.TestEventPattern(ctx, &eventbridge.TestEventPatternInput{
+		Event:        aws.String(event),
+		EventPattern: aws.String(pattern),
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.Result, nil
+}
+
+// errPatternMismatch is returned by checkInput when the input event can't match the rule.
+var errPatternMismatch = errors.New("pattern does not match input")
+
+// checkInput verifies the input event, as delivered to account and region, matches eventPattern. The
+// pattern is evaluated locally, falling back to the TestEventPattern API for operators not supported locally.
+func (e *eventbridgeClient) checkInput(ctx context.Context, event, eventPattern, account, region string) error {
+	delivered, err := deliveredEvent(event, account, region)
+	if err != nil {
+		return fmt.Errorf("invalid input event: %w", err)
+	}
+
+	var ok bool
+	var reason string
+	p, err := parseEventPattern(eventPattern)
+	if err == nil {
+		ok, reason, err = p.match(delivered)
+	}
+	if err != nil {
+		log.Printf("can't evaluate the pattern locally (%v), using TestEventPattern...", err)
+		if ok, err = e.matchesPattern(ctx, delivered, eventPattern); err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		if reason != "" {
+			return fmt.Errorf("%w: %s", errPatternMismatch, reason)
+		}
+		return errPatternMismatch
+	}
+	return nil
+}
+
+// putEvent sends event to the bus and returns the id EventBridge assigned to it.
+func (e *eventbridgeClient) putEvent(ctx context.Context, event string) (string, error) {
+	log.Printf("putting event: %s", event)
+	return e.put(ctx, event)
+}
+
+// put is putEvent without logging, for high volumes.
+func (e *eventbridgeClient) put(ctx context.Context, event string) (string, error) {
+	ev, err := parseInputEvent(event)
+	if err != nil {
+		return "", err
 	}
 
 	resp, err := e.client.PutEvents(ctx, &eventbridge.PutEventsInput{
@@ -115,14 +256,14 @@ func (e *eventbridgeClient) putEvent(ctx context.Context, event string) error {
 		},
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if resp.FailedEntryCount > 0 {
-		return errors.New(*resp.Entries[0].ErrorMessage)
+		return "", errors.New(*resp.Entries[0].ErrorMessage)
 	}
 
-	return nil
+	return aws.ToString(resp.Entries[0].EventId), nil
 }
 
 func (e *eventbridgeClient) putTarget(ctx context.Context, sqsArn string) error {
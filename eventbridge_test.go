@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_deliveredEvent(t *testing.T) {
+	t.Run("builds the delivered envelope", func(t *testing.T) {
+		event, err := resolveInputEvent("file://testdata/event_ci_success.json")
+		require.NoError(t, err)
+
+		got, err := deliveredEvent(event, "123456789012", "eu-north-1")
+		require.NoError(t, err)
+
+		var ev map[string]any
+		require.NoError(t, json.Unmarshal([]byte(got), &ev))
+		assert.Equal(t, "0", ev["version"])
+		assert.Equal(t, "beta", ev["source"])
+		assert.Equal(t, "poc.succeeded", ev["detail-type"])
+		assert.Equal(t, "123456789012", ev["account"])
+		assert.Equal(t, "eu-north-1", ev["region"])
+		assert.Equal(t, map[string]any{"channel": "web"}, ev["detail"])
+		assert.NotEmpty(t, ev["id"])
+		assert.NotEmpty(t, ev["time"])
+	})
+
+	t.Run("empty detail", func(t *testing.T) {
+		got, err := deliveredEvent(`{"source": "beta", "detail-type": "poc"}`, "123456789012", "eu-north-1")
+		require.NoError(t, err)
+		assert.Contains(t, got, `"detail":{}`)
+	})
+
+	t.Run("invalid detail", func(t *testing.T) {
+		_, err := deliveredEvent(`{"source": "beta", "detail": "{not json"}`, "123456789012", "eu-north-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("input event not matching the pattern", func(t *testing.T) {
+		pattern, _, err := resolveEventPattern(context.Background(), &dataSources{}, "file://testdata/eventpattern.json")
+		require.NoError(t, err)
+		p, err := parseEventPattern(pattern)
+		require.NoError(t, err)
+
+		for file, want := range map[string]string{
+			"file://testdata/event_ci_success.json": "",
+			"file://testdata/event_ci_fail.json":    `source: "alpha" does not match ["beta"]`,
+		} {
+			event, err := resolveInputEvent(file)
+			require.NoError(t, err)
+			delivered, err := deliveredEvent(event, "123456789012", "eu-north-1")
+			require.NoError(t, err)
+
+			ok, reason, err := p.match(delivered)
+			assert.NoError(t, err)
+			assert.Equal(t, want == "", ok, file)
+			assert.Equal(t, want, reason, file)
+		}
+	})
+}
+
+func Test_parseInputEvents(t *testing.T) {
+	events, err := parseInputEvents(`{"source": "beta"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"source": "beta"}`}, events)
+
+	events, err = parseInputEvents(` [{"source": "a"}, {"source": "b"}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"source": "a"}`, `{"source": "b"}`}, events)
+
+	_, err = parseInputEvents(`[]`)
+	assert.Error(t, err)
+
+	_, err = parseInputEvents(`[{"source": `)
+	assert.Error(t, err)
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/urfave/cli/v3"
 )
 
 var flags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "preset",
+		Usage:   "Named preset of the " + configFile + " file, in the repository or home directory. Flags override the preset",
+		Sources: cli.EnvVars("EVENTBRIDGE_CLI_PRESET"),
+	},
 	&cli.StringFlag{
 		Name:    "profile",
 		Aliases: []string{"p"},
@@ -28,14 +34,64 @@ var flags = []cli.Flag{
 	&cli.StringFlag{
 		Name:    "eventpattern",
 		Aliases: []string{"e"},
-		Usage:   "EventBridge event pattern. Can be prefixed by 'file://' or 'sam://'",
+		Usage:   "EventBridge event pattern. Can be prefixed by 'file://', 'sam://', 'cfn://', 'cdk://', 'tf://', 'sls://', 'asyncapi://' or 'rule://', or '-' to read stdin",
 		Value:   fmt.Sprintf(`{"source": [{"anything-but": ["%s"]}]}`, namespace),
 	},
+	&cli.StringSliceFlag{
+		Name:  "parameter-overrides",
+		Usage: "Template parameter, export or attribute used to resolve 'sam://', 'cfn://' and 'cdk://' patterns, as key=value. Can be repeated",
+	},
 	&cli.BoolFlag{
 		Name:    "prettyjson",
 		Aliases: []string{"j"},
 		Usage:   "Pretty JSON output",
 	},
+	&cli.IntFlag{
+		Name:    "workers",
+		Aliases: []string{"w"},
+		Usage:   "Number of parallel SQS receive loops",
+		Value:   1,
+	},
+	&cli.BoolFlag{
+		Name:  "ordered",
+		Usage: "Print events ordered by delivery time instead of as received. Adds up to 1s of latency",
+	},
+	&cli.IntFlag{
+		Name:  "queue-depth-warning",
+		Usage: "Warn when the temporary queue backlog exceeds this many messages. 0 disables",
+		Value: 1000,
+	},
+	&cli.IntFlag{
+		Name:  "max-events",
+		Usage: "Stop listening after this many events. 0 listens until interrupted",
+	},
+	&cli.DurationFlag{
+		Name:  "duration",
+		Usage: "Stop listening after this duration (ie. 5m)",
+	},
+	&cli.StringFlag{
+		Name:  "until",
+		Usage: "Stop listening when an event matches. An event pattern (can be prefixed by 'file://') or a regular expression",
+	},
+	&cli.StringSliceFlag{
+		Name:  "var",
+		Usage: "Variable for input event templates and 'sls://' ${opt:...} options, as key=value. Can be repeated",
+	},
+	&cli.IntFlag{
+		Name:  "retry-max-attempts",
+		Usage: "Consecutive poller errors before giving up. 0 retries forever",
+		Value: defaultRetryPolicy.maxAttempts,
+	},
+	&cli.DurationFlag{
+		Name:  "retry-backoff",
+		Usage: "Poller delay after the first error, doubled on every retry",
+		Value: defaultRetryPolicy.initial,
+	},
+	&cli.DurationFlag{
+		Name:  "retry-max-backoff",
+		Usage: "Poller maximum delay between retries",
+		Value: defaultRetryPolicy.max,
+	},
 }
 
 var flagsCI = []cli.Flag{
@@ -48,7 +104,142 @@ var flagsCI = []cli.Flag{
 	&cli.StringFlag{
 		Name:    "inputevent",
 		Aliases: []string{"i"},
-		Usage:   "Input event. Can be prefixed by 'file://' or omitted if coming from other sources",
+		Usage:   "Input event, or a JSON array of input events sent in order. Can be prefixed by 'file://' or 'asyncapi://', or '-' to read stdin",
+	},
+	&cli.StringFlag{
+		Name:  "trigger",
+		Usage: "Shell command producing the event, run once the poller is ready instead of sending --inputevent",
+	},
+	&cli.DurationFlag{
+		Name:  "resend-interval",
+		Usage: "Interval between input event re-sends until an event is received",
+		Value: 3 * time.Second,
+	},
+	&cli.IntFlag{
+		Name:  "max-sends",
+		Usage: "Maximum number of input event sends. 0 re-sends until --timeout",
+	},
+	&cli.BoolFlag{
+		Name:  "no-resend",
+		Usage: "Send the input event only once, same as --max-sends 1",
+	},
+	&cli.DurationFlag{
+		Name:  "drain",
+		Usage: "Keep polling for this long after the first event to count duplicates. 0 disables",
+		Value: 2 * time.Second,
+	},
+	&cli.IntFlag{
+		Name:  "expect-count",
+		Usage: "Fail unless exactly this many events are delivered, duplicates included. 0 disables",
+	},
+	&cli.StringFlag{
+		Name:  "report",
+		Usage: "Write the CI result as JSON to this file",
+	},
+	&cli.StringFlag{
+		Name:  "junit",
+		Usage: "Write the CI result as a JUnit XML report to this file. Defaults to '" + defaultJUnitPath + "' under GitLab CI",
+	},
+	&cli.StringSliceFlag{
+		Name:  "expect",
+		Usage: "Event pattern of an expected event, one per step, in order. Can be prefixed by 'file://' and repeated",
+	},
+	&cli.BoolFlag{
+		Name:  "unordered",
+		Usage: "Expected events can be received in any order",
+	},
+	&cli.StringSliceFlag{
+		Name:  "assert",
+		Usage: "Event pattern the received event must also match, evaluated locally. Can be prefixed by 'file://' and repeated",
+	},
+	&cli.StringFlag{
+		Name:  "suite",
+		Usage: "Named CI suite of the " + configFile + " file, setting the flags of the suite and of its preset. Flags override the suite",
+	},
+}
+
+var flagsWait = []cli.Flag{
+	&cli.Int64Flag{
+		Name:    "timeout",
+		Aliases: []string{"t"},
+		Usage:   "Wait timeout in seconds",
+		Value:   60,
+	},
+	&cli.StringFlag{
+		Name:  "ready-file",
+		Usage: "File created once the listener is ready, removed on exit",
+	},
+	&cli.StringFlag{
+		Name:  "then",
+		Usage: "Shell command to run once the listener is ready (ie. invoking the event producer)",
+	},
+}
+
+var flagsBench = []cli.Flag{
+	&cli.IntFlag{
+		Name:    "count",
+		Aliases: []string{"n"},
+		Usage:   "Number of events to send",
+		Value:   100,
+	},
+	&cli.IntFlag{
+		Name:  "rate",
+		Usage: "Events sent per second. 0 sends as fast as the senders allow",
+		Value: 10,
+	},
+	&cli.IntFlag{
+		Name:    "concurrency",
+		Aliases: []string{"c"},
+		Usage:   "Number of parallel senders",
+		Value:   4,
+	},
+	&cli.StringFlag{
+		Name:  "source",
+		Usage: "Source of the bench events. The event pattern defaults to matching it",
+		Value: namespace + ".bench",
+	},
+	&cli.StringFlag{
+		Name:  "detail-type",
+		Usage: "Detail type of the bench events",
+		Value: "bench",
+	},
+	&cli.DurationFlag{
+		Name:  "wait",
+		Usage: "How long to wait for the target to activate and, after the last send, for late deliveries",
+		Value: 30 * time.Second,
+	},
+}
+
+var flagsCanary = []cli.Flag{
+	&cli.DurationFlag{
+		Name:  "interval",
+		Usage: "Interval between probes",
+		Value: time.Minute,
+	},
+	&cli.Int64Flag{
+		Name:  "timeout",
+		Usage: "Probes not delivered within this many seconds are failures",
+		Value: 30,
+	},
+	&cli.DurationFlag{
+		Name:  "warmup",
+		Usage: "Don't count failures until the first delivery, for at most this long, while the rule target activates",
+		Value: 2 * time.Minute,
+	},
+	&cli.StringFlag{
+		Name:  "listen",
+		Usage: "Address of the Prometheus /metrics endpoint",
+		Value: ":9090",
+	},
+	&cli.StringFlag{
+		Name:  "source",
+		Usage: "Source of the probe events. The event pattern defaults to matching it",
+		Value: namespace + ".canary",
+	},
+	&cli.StringFlag{
+		Name:  "detail-type",
+		Usage: "Detail type of the probe events",
+		Value: "canary",
 	},
 }
 
@@ -62,7 +253,30 @@ var flagsTestEventPattern = []cli.Flag{
 	&cli.StringFlag{
 		Name:     "inputevent",
 		Aliases:  []string{"i"},
-		Usage:    "Input event. Can be prefixed by 'file://'",
+		Usage:    "Input event. Can be prefixed by 'file://' or 'asyncapi://', or '-' to test every event of an NDJSON stream from stdin",
+		Required: true,
+	},
+}
+
+var flagsPut = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "inputevent",
+		Aliases:  []string{"i"},
+		Usage:    "Input event, or a JSON array of input events sent in order. Can be prefixed by 'file://' or 'asyncapi://', or '-' to read stdin",
 		Required: true,
 	},
 }
+
+var flagsPatternFmt = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "write",
+		Usage: "Rewrite the 'file://' pattern instead of printing it",
+	},
+}
+
+var flagsPatternLint = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "strict",
+		Usage: "Fail on warnings too",
+	},
+}
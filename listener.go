@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v3"
+)
+
+// listener owns the temporary resources delivering matched events to the poller:
+// EventBus --> EventBrige Rule --> SQS
+type listener struct {
+	eventbridge *eventbridgeClient
+	sqs         *sqsClient
+
+	eventPattern string
+	ruleArn      string
+	accountID    string
+	region       string
+
+	ruleCreation time.Duration // time taken by PutRule
+	linkedAt     time.Time     // when the queue became the rule target
+}
+
+// newListener creates the temporary rule, queue and target. Resources already created
+// are rolled back if a later step fails.
+func newListener(ctx context.Context, awsCfg aws.Config, eventBusName, eventPattern string) (*listener, error) {
+	ruleName := namespace + "-" + uuid.New().String()
+
+	// eventbridge client
+	log.Printf("creating eventBridge client for bus [%s]", eventBusName)
+	ebClient := newEventbridgeClient(awsCfg, eventBusName, ruleName)
+
+	// create temporary eventbridge event rule
+	log.Printf("creating temporary rule on bus [%s]: %s", ebClient.eventBusName, eventPattern)
+	start := time.Now()
+	ruleArn, err := ebClient.createRule(ctx, eventPattern)
+	if err != nil {
+		return nil, err
+	}
+	ruleCreation := time.Since(start)
+	log.Printf("created temporary rule on bus [%s] with arn: %s", ebClient.eventBusName, ruleArn)
+
+	// SQS client
+	arnParts := strings.Split(ruleArn, ":")
+	if len(arnParts) < 5 {
+		return nil, fmt.Errorf("unexpected rule ARN format: %s", ruleArn)
+	}
+	accountID := arnParts[4]
+	sqsClient := newSQSClient(awsCfg, accountID, ruleName)
+
+	// SQS queue
+	if err := sqsClient.createQueue(ctx, ruleArn); err != nil {
+		log.Printf("deleting temporary EventBus rule %s...", ruleArn)
+		if cleanupErr := ebClient.deleteRule(ctx); cleanupErr != nil {
+			log.Printf("failed to delete EventBus rule %s: %v", ruleArn, cleanupErr)
+		}
+		return nil, err
+	}
+	log.Printf("created temporary SQS queue with URL: %s", sqsClient.queueURL)
+
+	// EventBus --> SQS
+	if err := ebClient.putTarget(ctx, sqsClient.arn); err != nil {
+		log.Printf("deleting temporary SQS queue %s...", sqsClient.queueURL)
+		if cleanupErr := sqsClient.deleteQueue(ctx); cleanupErr != nil {
+			log.Printf("failed to delete SQS queue %s: %v", sqsClient.queueURL, cleanupErr)
+		}
+
+		log.Printf("deleting temporary EventBus rule %s...", ruleArn)
+		if cleanupErr := ebClient.deleteRule(ctx); cleanupErr != nil {
+			log.Printf("failed to delete EventBus rule %s: %v", ruleArn, cleanupErr)
+		}
+
+		return nil, err
+	}
+	log.Printf("linked EventBus --> SQS...")
+
+	return &listener{
+		eventbridge:  ebClient,
+		sqs:          sqsClient,
+		eventPattern: eventPattern,
+		ruleArn:      ruleArn,
+		accountID:    accountID,
+		region:       awsCfg.Region,
+		ruleCreation: ruleCreation,
+		linkedAt:     time.Now(),
+	}, nil
+}
+
+// cleanup deletes the temporary resources. It doesn't depend on the caller's context
+// so it still runs after an interrupt or timeout.
+func (l *listener) cleanup() error {
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var errs []error
+
+	log.Printf("deleting temporary SQS queue %s...", l.sqs.queueURL)
+	if err := l.sqs.deleteQueue(cleanupCtx); err != nil {
+		log.Printf("failed to delete SQS queue %s: %v", l.sqs.queueURL, err)
+		errs = append(errs, err)
+	}
+
+	log.Printf("removing EventBus target...")
+	if err := l.eventbridge.removeTarget(cleanupCtx); err != nil {
+		log.Printf("failed to remove EventBus target: %v", err)
+		errs = append(errs, err)
+	}
+
+	log.Printf("deleting temporary EventBus rule %s...", l.ruleArn)
+	if err := l.eventbridge.deleteRule(cleanupCtx); err != nil {
+		log.Printf("failed to delete EventBus rule %s: %v", l.ruleArn, err)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// retryPolicyFromFlags reads the poller retry policy from the global flags.
+func retryPolicyFromFlags(cmd *cli.Command) retryPolicy {
+	return retryPolicy{
+		initial:     cmd.Duration("retry-backoff"),
+		max:         cmd.Duration("retry-max-backoff"),
+		maxAttempts: cmd.Int("retry-max-attempts"),
+	}
+}
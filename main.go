@@ -4,210 +4,328 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/urfave/cli/v3"
 )
 
 const namespace = "eventbridge-cli"
 
+// exit codes for CI failures, so pipelines can retry infrastructure failures only.
+// Any other error exits with 1.
+const (
+	exitInvalidInput     = 2
+	exitPatternMismatch  = 3
+	exitTimeout          = 4
+	exitAssertionFailure = 5
+	exitAWSPermission    = 6
+	exitCleanupFailure   = 7
+
+	// 128 + SIGINT, as a shell reports a command stopped with CTRL-C
+	exitInterrupted = 130
+)
+
+// exit codes for listener stop conditions
+const (
+	exitStopMaxEvents = 10
+	exitStopDuration  = 11
+	exitStopUntil     = 12
+)
+
+// exitError makes main exit with a specific code. A nil err exits without logging.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
 	app := &cli.Command{
 		Name:     namespace,
 		Version:  "2.2.1",
 		Usage:    "AWS EventBridge cli",
 		Authors:  []any{"matteo ridolfi"},
+		Before:   applyConfig,
 		Action:   run,
 		Flags:    flags,
 		Commands: commands,
 	}
+	disableSliceFlagSeparator(app)
 
 	err := app.Run(context.Background(), os.Args)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		var exitErr *exitError
+		if !errors.As(err, &exitErr) || exitErr.err != nil {
+			log.Printf("error: %v", err)
+		}
+		os.Exit(exitCodeOf(err))
 	}
 }
 
-func run(ctx context.Context, cmd *cli.Command) error {
-	ruleName := namespace + "-" + uuid.New().String()
+// validateFlags rejects the flag combinations and values the modes can't run with.
+func validateFlags(cmd *cli.Command) error {
+	// the stop conditions are root flags, the other modes have their own
+	if cmd.Name != namespace {
+		for _, name := range []string{"max-events", "duration", "until"} {
+			if cmd.IsSet(name) {
+				return &exitError{code: exitInvalidInput, err: fmt.Errorf("--%s only applies to the listener, not to %s", name, cmd.Name)}
+			}
+		}
+	}
+
+	switch cmd.Name {
+	case "ci":
+		switch {
+		case cmd.String("inputevent") != "" && cmd.String("trigger") != "":
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("CI failed - --inputevent and --trigger can't be used together")}
+		case cmd.String("inputevent") == "" && cmd.String("trigger") == "":
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("CI failed - no input event or trigger provided, use the 'wait' command to listen to events from other sources")}
+		case cmd.Duration("resend-interval") <= 0 && cmd.Int("max-sends") != 1 && !cmd.Bool("no-resend"):
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("CI failed - --resend-interval must be positive, got %s", cmd.Duration("resend-interval"))}
+		case cmd.Int("max-sends") < 0:
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("CI failed - --max-sends can't be negative, got %d", cmd.Int("max-sends"))}
+		case cmd.Duration("drain") < 0:
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("CI failed - --drain can't be negative, got %s", cmd.Duration("drain"))}
+		}
 
-	// AWS config
-	awsCfg, err := newAWSConfig(ctx, cmd.String("profile"), cmd.String("region"))
-	if err != nil {
-		return err
+	case "bench":
+		for _, name := range []string{"count", "rate", "concurrency"} {
+			if cmd.Int(name) < 0 {
+				return &exitError{code: exitInvalidInput, err: fmt.Errorf("bench failed - --%s can't be negative, got %d", name, cmd.Int(name))}
+			}
+		}
+
+	case "canary":
+		switch {
+		case cmd.Duration("interval") <= 0:
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("--interval must be positive, got %s", cmd.Duration("interval"))}
+		case cmd.Int64("timeout") <= 0:
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("--timeout must be positive, got %d", cmd.Int64("timeout"))}
+		case cmd.Duration("warmup") < 0:
+			return &exitError{code: exitInvalidInput, err: fmt.Errorf("--warmup can't be negative, got %s", cmd.Duration("warmup"))}
+		}
 	}
+	return nil
+}
 
-	// eventbridge client
-	log.Printf("creating eventBridge client for bus [%s]", cmd.String("eventbusname"))
-	ebClient := newEventbridgeClient(awsCfg, cmd.String("eventbusname"), ruleName)
+// disableSliceFlagSeparator keeps the commas of slice flag values, ie. --var, --parameter-overrides
+// and --assert. Root flags are parsed by the command they are given after, so it applies to all of them.
+func disableSliceFlagSeparator(cmd *cli.Command) {
+	cmd.DisableSliceFlagSeparator = true
+	for _, sub := range cmd.Commands {
+		disableSliceFlagSeparator(sub)
+	}
+}
 
-	// create temporary eventbridge event rule
-	eventpattern := cmd.String("eventpattern")
+// exitCodeOf maps the error returned by a command to the process exit code.
+func exitCodeOf(err error) int {
+	var exitErr *exitError
+	var patternErr *types.InvalidEventPatternException
 	switch {
-	case strings.HasPrefix(eventpattern, "file://"):
-		eventpattern, err = dataFromFile(eventpattern)
-		if err != nil {
-			return err
-		}
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	// PutRule and TestEventPattern reject the patterns the local checks let through
+	case errors.As(err, &patternErr):
+		return exitInvalidInput
+	case isPermissionError(err):
+		return exitAWSPermission
+	}
+	return 1
+}
 
-	case strings.HasPrefix(eventpattern, "sam://"):
-		eventpattern, err = dataFromSAM(eventpattern)
-		if err != nil {
-			return err
+func run(ctx context.Context, cmd *cli.Command) (err error) {
+	var report *ciReport
+	if cmd.Name == "ci" {
+		report = newCIReport()
+		// published last, once the resources are cleaned up
+		defer func() {
+			report.finish(err)
+			if path := cmd.String("report"); path != "" {
+				if writeErr := report.write(path); writeErr != nil {
+					log.Printf("failed to write report %s: %v", path, writeErr)
+				}
+			}
+			publishReport(report, cmd.String("junit"))
+		}()
+	}
+
+	if err := validateFlags(cmd); err != nil {
+		return err
+	}
+
+	// validate the listener stop condition before creating any resource
+	var until func(string) bool
+	if expr := cmd.String("until"); expr != "" {
+		var err error
+		if until, err = newEventMatcher(expr); err != nil {
+			return &exitError{code: exitInvalidInput, err: err}
 		}
 	}
 
-	log.Printf("creating temporary rule on bus [%s]: %s", ebClient.eventBusName, eventpattern)
-	ruleArn, err := ebClient.createRule(ctx, eventpattern)
+	// AWS config
+	awsCfg, err := newAWSConfig(ctx, cmd.String("profile"), cmd.String("region"))
 	if err != nil {
 		return err
 	}
-	log.Printf("created temporary rule on bus [%s] with arn: %s", ebClient.eventBusName, ruleArn)
 
-	// SQS client
-	arnParts := strings.Split(ruleArn, ":")
-	if len(arnParts) < 5 {
-		return fmt.Errorf("unexpected rule ARN format: %s", ruleArn)
+	src, err := dataSourcesFromFlags(cmd, func(context.Context) (aws.Config, error) { return awsCfg, nil })
+	if err != nil {
+		return err
+	}
+	eventpattern, eventBus, err := resolveEventPattern(ctx, src, cmd.String("eventpattern"))
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+	eventBusName := cmd.String("eventbusname")
+	if eventBus != "" && eventBus != eventBusName {
+		if cmd.IsSet("eventbusname") {
+			log.Printf("event pattern is deployed on bus [%s], listening on bus [%s]", eventBus, eventBusName)
+		} else {
+			eventBusName = eventBus
+		}
+	}
+	if (cmd.Name == "bench" || cmd.Name == "canary") && !cmd.IsSet("eventpattern") {
+		// only deliver the synthetic events
+		eventpattern = fmt.Sprintf(`{"source": [%q]}`, cmd.String("source"))
 	}
-	accountID := arnParts[4]
-	sqsClient := newSQSClient(awsCfg, accountID, ruleName)
 
-	// SQS queue
-	if err := sqsClient.createQueue(ctx, ruleArn); err != nil {
-		log.Printf("deleting temporary EventBus rule %s...", ruleArn)
-		if cleanupErr := ebClient.deleteRule(ctx); cleanupErr != nil {
-			log.Printf("failed to delete EventBus rule %s: %v", ruleArn, cleanupErr)
+	// PutRule errors are terse, point at the pattern issues first
+	for _, f := range lintPattern(eventpattern) {
+		if !f.warning {
+			log.Printf("event pattern %s", f)
 		}
-		return err
 	}
-	log.Printf("created temporary SQS queue with URL: %s", sqsClient.queueURL)
 
-	// EventBus --> SQS
-	if err := ebClient.putTarget(ctx, sqsClient.arn); err != nil {
-		log.Printf("deleting temporary SQS queue %s...", sqsClient.queueURL)
-		if cleanupErr := sqsClient.deleteQueue(ctx); cleanupErr != nil {
-			log.Printf("failed to delete SQS queue %s: %v", sqsClient.queueURL, cleanupErr)
+	// fail fast if the canary metrics address is unavailable
+	var metricsListener net.Listener
+	if cmd.Name == "canary" {
+		if metricsListener, err = net.Listen("tcp", cmd.String("listen")); err != nil {
+			return fmt.Errorf("canary failed - %w", err)
 		}
+		defer metricsListener.Close()
+	}
 
-		log.Printf("deleting temporary EventBus rule %s...", ruleArn)
-		if cleanupErr := ebClient.deleteRule(ctx); cleanupErr != nil {
-			log.Printf("failed to delete EventBus rule %s: %v", ruleArn, cleanupErr)
+	// read and check the CI input before creating any resource
+	var in *ciInput
+	if cmd.Name == "ci" {
+		eb := newEventbridgeClient(awsCfg, eventBusName, "")
+		if in, err = readCIInput(ctx, cmd, src, eb, eventpattern, report); err != nil {
+			return err
 		}
+	}
 
+	// EventBus --> EventBrige Rule --> SQS
+	l, err := newListener(ctx, awsCfg, eventBusName, eventpattern)
+	if err != nil {
 		return err
 	}
-	log.Printf("linked EventBus --> SQS...")
+	l.sqs.retry = retryPolicyFromFlags(cmd)
 
-	// defer cleanup resources
+	// defer cleanup resources, failing the run if they can't be deleted
 	defer func() {
-		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		log.Printf("deleting temporary SQS queue %s...", sqsClient.queueURL)
-		if err := sqsClient.deleteQueue(cleanupCtx); err != nil {
-			log.Printf("failed to delete SQS queue %s: %v", sqsClient.queueURL, err)
+		cleanupErr := l.cleanup()
+		if report != nil {
+			report.cleanup(cleanupErr)
 		}
-
-		log.Printf("removing EventBus target...")
-		if err := ebClient.removeTarget(cleanupCtx); err != nil {
-			log.Printf("failed to remove EventBus target: %v", err)
-		}
-
-		log.Printf("deleting temporary EventBus rule %s...", ruleArn)
-		if err := ebClient.deleteRule(cleanupCtx); err != nil {
-			log.Printf("failed to delete EventBus rule %s: %v", ruleArn, err)
+		if cleanupErr != nil && err == nil {
+			err = &exitError{code: exitCleanupFailure, err: fmt.Errorf("cleanup failed: %w", cleanupErr)}
 		}
 	}()
 
-	// switch between CI and standard modes
+	// switch between CI, wait, bench, canary and standard modes
 	switch cmd.Name {
 	case "ci":
-		log.Printf("CI mode")
-
-		timeout := time.Duration(cmd.Int64("timeout")) * time.Second
-		pollCtx, cancelPoll := context.WithTimeout(ctx, timeout)
-		defer cancelPoll()
-
-		signalChan := make(chan os.Signal, 1)
-		doneChan := make(chan struct{})
-		readyChan := make(chan struct{})
-		signal.Notify(signalChan, os.Interrupt)
-		defer signal.Stop(signalChan)
-		go sqsClient.pollQueueCI(pollCtx, doneChan, readyChan, cmd.Bool("prettyjson"))
-
-		// wait for poller to start before sending the event
-		<-readyChan
-
-		// read input event from cli or file
-		event := cmd.String("inputevent")
-		if event == "" {
-			cancelPoll()
-			<-doneChan
-			return fmt.Errorf("CI failed - no input event provided")
-		}
-		if strings.HasPrefix(event, "file://") {
-			event, err = dataFromFile(event)
-			if err != nil {
-				return err
-			}
-		}
+		return runCI(ctx, cmd, l, in, report)
+	case "wait":
+		return runWait(ctx, cmd, l)
+	case "bench":
+		return runBench(ctx, cmd, l)
+	case "canary":
+		return runCanary(ctx, cmd, l, metricsListener)
+	}
 
-		// EventBridge does not guarantee that a newly created target is immediately active.
-		// Send the event once, then re-send on a short interval (bounded by --timeout) so we
-		// proceed as soon as the target is ready, without flooding it with duplicates.
-		// https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-troubleshooting.html#eb-rule-does-not-match
-		const retryInterval = 3 * time.Second
-		if err := ebClient.putEvent(ctx, event); err != nil {
-			return err
-		}
+	return listen(ctx, cmd, l, until)
+}
 
-		ticker := time.NewTicker(retryInterval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-doneChan:
-				log.Printf("CI successful - message received")
-				return nil
-			case <-signalChan:
-				cancelPoll()
-				<-doneChan
-				return nil
-			case <-pollCtx.Done():
-				<-doneChan
-				return fmt.Errorf("CI failed - didn't receive any event within %s", timeout)
-			case <-ticker.C:
-				log.Printf("no event received yet, retrying...")
-				if err := ebClient.putEvent(ctx, event); err != nil {
-					return err
-				}
-			}
+// listen prints events until interrupted, a stop condition is met or the poller fails.
+func listen(ctx context.Context, cmd *cli.Command, l *listener, until func(string) bool) error {
+	pollCtx, cancelPoll := context.WithCancel(ctx)
+	defer cancelPoll()
+
+	// stop conditions
+	var stop *exitError
+	maxEvents, events := cmd.Int("max-events"), 0
+	onMessage := func(body string) bool {
+		events++
+		switch {
+		case until != nil && until(body):
+			log.Printf("received an event matching --until, stopping poller...")
+			stop = &exitError{code: exitStopUntil}
+		case maxEvents > 0 && events >= maxEvents:
+			log.Printf("received %d events, stopping poller...", events)
+			stop = &exitError{code: exitStopMaxEvents}
 		}
+		return stop != nil
+	}
 
-	default:
-		pollCtx, cancelPoll := context.WithCancel(ctx)
-		defer cancelPoll()
-
-		signalChan := make(chan os.Signal, 1)
-		doneChan := make(chan struct{})
-		signal.Notify(signalChan, os.Interrupt)
-		defer signal.Stop(signalChan)
-		go sqsClient.pollQueue(pollCtx, doneChan, cmd.Bool("prettyjson"))
-
-		// wait for a SIGINT (ie. CTRL-C) or poller exit
-		select {
-		case <-signalChan:
-			log.Printf("received an interrupt, stopping poller...")
-			cancelPoll()
-			<-doneChan
-		case <-doneChan:
+	var deadline <-chan time.Time
+	if d := cmd.Duration("duration"); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	signalChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	go l.sqs.pollQueue(pollCtx, doneChan, pollOptions{
+		prettyJSON:   cmd.Bool("prettyjson"),
+		workers:      cmd.Int("workers"),
+		ordered:      cmd.Bool("ordered"),
+		depthWarning: cmd.Int("queue-depth-warning"),
+		onMessage:    onMessage,
+	})
+
+	// wait for a SIGINT (ie. CTRL-C), a stop condition or poller exit
+	select {
+	case <-signalChan:
+		log.Printf("received an interrupt, stopping poller...")
+		cancelPoll()
+		<-doneChan
+	case <-deadline:
+		log.Printf("listened for %s, stopping poller...", cmd.Duration("duration"))
+		cancelPoll()
+		<-doneChan
+		return &exitError{code: exitStopDuration}
+	case <-doneChan:
+		if l.sqs.err != nil {
+			return fmt.Errorf("poller stopped: %w", l.sqs.err)
+		}
+		if stop != nil {
+			return stop
 		}
 	}
 
@@ -225,12 +343,14 @@ func runTestEventPattern(ctx context.Context, cmd *cli.Command) error {
 	log.Printf("creating eventBridge client for bus [%s]", cmd.String("eventbusname"))
 	ebClient := newEventbridgeClient(awsCfg, cmd.String("eventbusname"), "")
 
-	inputevent := cmd.String("inputevent")
-	if strings.HasPrefix(inputevent, "file://") {
-		inputevent, err = dataFromFile(inputevent)
-		if err != nil {
-			return err
-		}
+	// a stream of events, each tested in turn
+	if isStdin(cmd.String("inputevent")) {
+		return testEventStream(ctx, cmd, ebClient, stdin)
+	}
+
+	inputevent, err := inputEventFromFlags(cmd)
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
 	}
 
 	err = ebClient.testEventPattern(ctx, inputevent, cmd.String("eventrule"))
@@ -241,7 +361,52 @@ func runTestEventPattern(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
+// testEventStream tests every event of a stream against the rules.
+func testEventStream(ctx context.Context, cmd *cli.Command, ebClient *eventbridgeClient, r io.Reader) error {
+	vars, err := parseVars(cmd.StringSlice("var"))
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+
+	rules, err := ebClient.listRules(ctx, cmd.String("eventrule"))
+	if err != nil {
+		return err
+	}
+
+	return readEventStream(r, vars, func(n int, event string) error {
+		log.Printf("event %d: %s", n, event)
+		return ebClient.testRules(ctx, rules, event)
+	})
+}
+
+// dataSourcesFromFlags builds the event pattern sources with the --parameter-overrides and --var values.
+func dataSourcesFromFlags(cmd *cli.Command, loadConfig func(context.Context) (aws.Config, error)) (*dataSources, error) {
+	parameters, err := parseVars(cmd.StringSlice("parameter-overrides"))
+	if err != nil {
+		return nil, &exitError{code: exitInvalidInput, err: fmt.Errorf("invalid --parameter-overrides: %w", err)}
+	}
+	vars, err := parseVars(cmd.StringSlice("var"))
+	if err != nil {
+		return nil, &exitError{code: exitInvalidInput, err: err}
+	}
+	return newDataSources(loadConfig, parameters, vars), nil
+}
+
 func newAWSConfig(ctx context.Context, profile, region string) (aws.Config, error) {
+	awsCfg, err := loadAWSConfig(ctx, profile, region)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return aws.Config{}, err
+	}
+
+	return awsCfg, nil
+}
+
+// loadAWSConfig loads the shared AWS config without resolving credentials.
+func loadAWSConfig(ctx context.Context, profile, region string) (aws.Config, error) {
 	var opts []func(*config.LoadOptions) error
 	if profile != "" {
 		opts = append(opts, config.WithSharedConfigProfile(profile))
@@ -252,13 +417,12 @@ func newAWSConfig(ctx context.Context, profile, region string) (aws.Config, erro
 		return aws.Config{}, err
 	}
 
-	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
-		return aws.Config{}, err
-	}
-
 	if region != "" {
 		awsCfg.Region = region
 	}
+	if awsCfg.Credentials != nil {
+		awsCfg.Credentials = credentialsProvider{awsCfg.Credentials}
+	}
 
 	return awsCfg, nil
 }
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// errUnsupportedOperator is returned when a pattern uses an operator the local matcher
+// doesn't implement. Callers can fall back to the TestEventPattern API.
+var errUnsupportedOperator = errors.New("unsupported operator")
+
+// eventPattern is an EventBridge event pattern evaluated locally.
+// https://docs.aws.amazon.com/eventbridge/latest/userguide/eb-event-patterns-content-based-filtering.html
+type eventPattern map[string]any
+
+func parseEventPattern(s string) (eventPattern, error) {
+	var p eventPattern
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		return nil, fmt.Errorf("invalid event pattern: %w", err)
+	}
+	if p == nil {
+		return nil, errors.New("invalid event pattern: must be a JSON object")
+	}
+	return p, nil
+}
+
+// match reports whether event (a delivered EventBridge event) matches the pattern.
+// When it doesn't, reason describes the first field that disagrees.
+func (p eventPattern) match(event string) (bool, string, error) {
+	var ev map[string]any
+	if err := json.Unmarshal([]byte(event), &ev); err != nil {
+		return false, "", fmt.Errorf("invalid event: %w", err)
+	}
+
+	reason, err := matchObject(p, ev, "")
+	if err != nil {
+		return false, "", err
+	}
+	return reason == "", reason, nil
+}
+
+// matchObject returns an empty string if event matches pattern, otherwise the mismatch reason.
+func matchObject(pattern map[string]any, event map[string]any, path string) (string, error) {
+	keys := make([]string, 0, len(pattern))
+	for k := range pattern {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		field := joinPath(path, key)
+
+		if key == "$or" {
+			branches, ok := pattern[key].([]any)
+			if !ok {
+				return "", fmt.Errorf("%s: $or must be an array of objects", field)
+			}
+			matched := false
+			for _, b := range branches {
+				branch, ok := b.(map[string]any)
+				if !ok {
+					return "", fmt.Errorf("%s: $or must be an array of objects", field)
+				}
+				reason, err := matchObject(branch, event, path)
+				if err != nil {
+					return "", err
+				}
+				if reason == "" {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Sprintf("%s: none of the branches matched", field), nil
+			}
+			continue
+		}
+
+		value, present := event[key]
+		switch v := pattern[key].(type) {
+		case map[string]any:
+			nested, _ := value.(map[string]any)
+			reason, err := matchObject(v, nested, field)
+			if err != nil || reason != "" {
+				return reason, err
+			}
+
+		case []any:
+			ok, err := matchLeaf(v, value, present, field)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				got := "missing"
+				if present {
+					got = toJSON(value)
+				}
+				return fmt.Sprintf("%s: %s does not match %s", field, got, toJSON(v)), nil
+			}
+
+		default:
+			return "", fmt.Errorf("%s: pattern values must be objects or arrays, got %s", field, toJSON(v))
+		}
+	}
+
+	return "", nil
+}
+
+// diff returns every field of event not matching the pattern, as pairs of "-" expected
+// and "+" actual lines.
+func (p eventPattern) diff(event string) ([]string, error) {
+	var ev map[string]any
+	if err := json.Unmarshal([]byte(event), &ev); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+
+	var lines []string
+	err := diffObject(p, ev, "", &lines)
+	return lines, err
+}
+
+func diffObject(pattern map[string]any, event map[string]any, path string, lines *[]string) error {
+	keys := make([]string, 0, len(pattern))
+	for k := range pattern {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		field := joinPath(path, key)
+
+		if key == "$or" {
+			reason, err := matchObject(map[string]any{key: pattern[key]}, event, path)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				*lines = append(*lines, "- "+field+": "+toJSON(pattern[key]), "+ "+field+": none of the branches matched")
+			}
+			continue
+		}
+
+		value, present := event[key]
+		switch v := pattern[key].(type) {
+		case map[string]any:
+			nested, _ := value.(map[string]any)
+			if err := diffObject(v, nested, field, lines); err != nil {
+				return err
+			}
+
+		case []any:
+			ok, err := matchLeaf(v, value, present, field)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				got := "missing"
+				if present {
+					got = toJSON(value)
+				}
+				*lines = append(*lines, "- "+field+": "+toJSON(v), "+ "+field+": "+got)
+			}
+
+		default:
+			return fmt.Errorf("%s: pattern values must be objects or arrays, got %s", field, toJSON(v))
+		}
+	}
+
+	return nil
+}
+
+// matchLeaf matches an event value against a list of matchers. Array values match
+// when any of their elements does.
+func matchLeaf(matchers []any, value any, present bool, field string) (bool, error) {
+	values := []any{value}
+	if arr, ok := value.([]any); ok {
+		values = arr
+	}
+
+	for _, m := range matchers {
+		if op, ok := m.(map[string]any); ok {
+			if exists, ok := op["exists"]; ok && len(op) == 1 {
+				want, ok := exists.(bool)
+				if !ok {
+					return false, fmt.Errorf("%s: exists must be true or false", field)
+				}
+				if present == want {
+					return true, nil
+				}
+				continue
+			}
+		}
+
+		if !present {
+			continue
+		}
+		for _, v := range values {
+			ok, err := matchValue(m, v, field)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func matchValue(matcher, value any, field string) (bool, error) {
+	op, ok := matcher.(map[string]any)
+	if !ok {
+		return matchExact(matcher, value), nil
+	}
+	if len(op) != 1 {
+		return false, fmt.Errorf("%s: matcher must have exactly one operator, got %s", field, toJSON(op))
+	}
+
+	for name, arg := range op {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case", "wildcard":
+			return matchString(name, arg, value, field)
+
+		case "anything-but":
+			switch a := arg.(type) {
+			case []any:
+				for _, x := range a {
+					if matchExact(x, value) {
+						return false, nil
+					}
+				}
+				return true, nil
+			case map[string]any:
+				if len(a) != 1 {
+					return false, fmt.Errorf("%s: anything-but must have exactly one operator", field)
+				}
+				for inner, innerArg := range a {
+					switch inner {
+					case "prefix", "suffix", "equals-ignore-case", "wildcard":
+						ok, err := matchString(inner, innerArg, value, field)
+						return !ok && err == nil, err
+					}
+					return false, fmt.Errorf("%s: %w anything-but/%s", field, errUnsupportedOperator, inner)
+				}
+			default:
+				return !matchExact(a, value), nil
+			}
+
+		case "numeric":
+			return matchNumeric(arg, value, field)
+
+		case "cidr":
+			cidr, ok := arg.(string)
+			if !ok {
+				return false, fmt.Errorf("%s: cidr must be a string", field)
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return false, fmt.Errorf("%s: %w", field, err)
+			}
+			s, _ := value.(string)
+			ip := net.ParseIP(s)
+			return ip != nil && network.Contains(ip), nil
+
+		case "exists":
+			return false, fmt.Errorf("%s: exists can't be combined with other matchers", field)
+		}
+
+		return false, fmt.Errorf("%s: %w %q", field, errUnsupportedOperator, name)
+	}
+
+	return false, nil
+}
+
+func matchExact(matcher, value any) bool {
+	switch m := matcher.(type) {
+	case nil:
+		return value == nil
+	case string, bool, float64:
+		return m == value
+	}
+	return false
+}
+
+func matchString(op string, arg, value any, field string) (bool, error) {
+	s, ok := value.(string)
+	if !ok {
+		return false, nil
+	}
+
+	fold := false
+	if m, ok := arg.(map[string]any); ok && (op == "prefix" || op == "suffix") {
+		if arg, ok = m["equals-ignore-case"]; !ok || len(m) != 1 {
+			return false, fmt.Errorf("%s: %s only accepts a string or equals-ignore-case", field, op)
+		}
+		fold = true
+	}
+	want, ok := arg.(string)
+	if !ok {
+		return false, fmt.Errorf("%s: %s must be a string", field, op)
+	}
+	if fold {
+		s, want = strings.ToLower(s), strings.ToLower(want)
+	}
+
+	switch op {
+	case "prefix":
+		return strings.HasPrefix(s, want), nil
+	case "suffix":
+		return strings.HasSuffix(s, want), nil
+	case "equals-ignore-case":
+		return strings.EqualFold(s, want), nil
+	case "wildcard":
+		re, err := wildcardRegexp(want)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", field, err)
+		}
+		return re.MatchString(s), nil
+	}
+	return false, nil
+}
+
+// wildcardRegexp converts an EventBridge wildcard (* matches any sequence, \* is a literal star).
+func wildcardRegexp(w string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(w); i++ {
+		switch {
+		case w[i] == '\\' && i+1 < len(w) && (w[i+1] == '*' || w[i+1] == '\\'):
+			b.WriteString(regexp.QuoteMeta(w[i+1 : i+2]))
+			i++
+		case w[i] == '*':
+			b.WriteString(".*")
+		default:
+			b.WriteString(regexp.QuoteMeta(w[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func matchNumeric(arg, value any, field string) (bool, error) {
+	conds, ok := arg.([]any)
+	if !ok || len(conds) == 0 || len(conds)%2 != 0 {
+		return false, fmt.Errorf("%s: numeric must be a list of operator/value pairs", field)
+	}
+
+	n, ok := value.(float64)
+	if !ok {
+		return false, nil
+	}
+
+	for i := 0; i < len(conds); i += 2 {
+		op, _ := conds[i].(string)
+		x, ok := conds[i+1].(float64)
+		if !ok {
+			return false, fmt.Errorf("%s: numeric %q must be followed by a number", field, op)
+		}
+
+		var res bool
+		switch op {
+		case "=":
+			res = n == x
+		case "<":
+			res = n < x
+		case "<=":
+			res = n <= x
+		case ">":
+			res = n > x
+		case ">=":
+			res = n >= x
+		default:
+			return false, fmt.Errorf("%s: unknown numeric operator %q", field, op)
+		}
+		if !res {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func toJSON(v any) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// newEventMatcher builds a predicate on received event bodies from an event pattern
+// (inline JSON or 'file://') or, failing that, a regular expression.
+func newEventMatcher(expr string) (func(body string) bool, error) {
+	if strings.HasPrefix(expr, "file://") {
+		var err error
+		if expr, err = dataFromFile(expr); err != nil {
+			return nil, err
+		}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(expr), "{") {
+		p, err := parseEventPattern(expr)
+		if err != nil {
+			return nil, err
+		}
+		return func(body string) bool {
+			ok, _, err := p.match(body)
+			if err != nil {
+				log.Printf("%s event not matched against --until: %v", color.YellowString("warning:"), err)
+				return false
+			}
+			return ok
+		}, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	return re.MatchString, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// numericPhrases describe the numeric operators.
+var numericPhrases = map[string]string{
+	"=":  "",
+	">":  "more than ",
+	">=": "at least ",
+	"<":  "less than ",
+	"<=": "at most ",
+}
+
+// explainPattern describes the events a linted pattern matches in plain English.
+func explainPattern(p eventPattern) string {
+	var b strings.Builder
+	b.WriteString("Matches events where:\n")
+	explainObject(&b, p, "", "  ")
+	return b.String()
+}
+
+// explainObject writes a line per field, all of them must match. $or comes last.
+func explainObject(b *strings.Builder, obj map[string]any, path, indent string) {
+	keys := slices.Sorted(maps.Keys(obj))
+	if i := slices.Index(keys, "$or"); i >= 0 {
+		keys = append(slices.Delete(keys, i, i+1), "$or")
+	}
+	for _, key := range keys {
+		field := joinPath(path, key)
+
+		switch v := obj[key].(type) {
+		case map[string]any:
+			explainObject(b, v, field, indent)
+
+		case []any:
+			if key != "$or" {
+				fmt.Fprintf(b, "%s- %s %s\n", indent, field, explainMatchers(v))
+				continue
+			}
+			fmt.Fprintf(b, "%s- any of:\n", indent)
+			for i, branch := range v {
+				branchObj, _ := branch.(map[string]any)
+				fmt.Fprintf(b, "%s  %d. all of:\n", indent, i+1)
+				explainObject(b, branchObj, path, indent+"     ")
+			}
+		}
+	}
+}
+
+// explainMatchers describes a field matcher list, any of them must match.
+func explainMatchers(matchers []any) string {
+	var values []string
+	var phrases []string
+	for _, m := range matchers {
+		op, ok := m.(map[string]any)
+		if !ok {
+			values = append(values, explainValue(m))
+			continue
+		}
+		for name, arg := range op {
+			phrases = append(phrases, explainOperator(name, arg))
+		}
+	}
+
+	switch len(values) {
+	case 0:
+	case 1:
+		phrases = append([]string{"is " + values[0]}, phrases...)
+	default:
+		phrases = append([]string{"is one of " + strings.Join(values, ", ")}, phrases...)
+	}
+	return strings.Join(phrases, ", or ")
+}
+
+func explainOperator(name string, arg any) string {
+	switch name {
+	case "prefix", "suffix":
+		verb := map[string]string{"prefix": "begins with", "suffix": "ends with"}[name]
+		if m, ok := arg.(map[string]any); ok {
+			return fmt.Sprintf("%s %s, ignoring case", verb, explainValue(m["equals-ignore-case"]))
+		}
+		return verb + " " + explainValue(arg)
+
+	case "equals-ignore-case":
+		return fmt.Sprintf("is %s, ignoring case", explainValue(arg))
+
+	case "wildcard":
+		return "matches the wildcard " + explainValue(arg)
+
+	case "cidr":
+		return fmt.Sprintf("is an IP address in %v", arg)
+
+	case "exists":
+		if arg == true {
+			return "exists"
+		}
+		return "does not exist"
+
+	case "numeric":
+		conds, _ := arg.([]any)
+		var parts []string
+		for i := 0; i+1 < len(conds); i += 2 {
+			op, _ := conds[i].(string)
+			parts = append(parts, numericPhrases[op]+explainValue(conds[i+1]))
+		}
+		return "is " + strings.Join(parts, " and ")
+
+	case "anything-but":
+		switch a := arg.(type) {
+		case []any:
+			values := make([]string, 0, len(a))
+			for _, v := range a {
+				values = append(values, explainValue(v))
+			}
+			if len(values) == 1 {
+				return "is anything but " + values[0]
+			}
+			return "is none of " + strings.Join(values, ", ")
+
+		case map[string]any:
+			for inner, innerArg := range a {
+				values, ok := innerArg.([]any)
+				if !ok {
+					values = []any{innerArg}
+				}
+				quoted := make([]string, 0, len(values))
+				for _, v := range values {
+					quoted = append(quoted, explainValue(v))
+				}
+				switch inner {
+				case "prefix":
+					return "does not begin with " + strings.Join(quoted, " or ")
+				case "suffix":
+					return "does not end with " + strings.Join(quoted, " or ")
+				case "equals-ignore-case":
+					return "is not " + strings.Join(quoted, " or ") + ", ignoring case"
+				case "wildcard":
+					return "does not match the wildcard " + strings.Join(quoted, " or ")
+				}
+			}
+
+		default:
+			return "is anything but " + explainValue(a)
+		}
+	}
+
+	return fmt.Sprintf("matches %s", toJSON(map[string]any{name: arg}))
+}
+
+func explainValue(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if x == "" {
+			return "empty"
+		}
+		return fmt.Sprintf("%q", x)
+	}
+	return toJSON(v)
+}
@@ -0,0 +1,57 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_explainPattern(t *testing.T) {
+	p, err := parseEventPattern(`{
+		"source": ["orders", "shipping"],
+		"detail-type": [{"prefix": "order."}],
+		"detail": {
+			"userId": [null],
+			"lastName": [""],
+			"price": [{"numeric": [">", 10, "<=", 20]}, {"numeric": ["=", 100]}],
+			"productName": [{"exists": true}],
+			"coupon": [{"exists": false}],
+			"weather": [{"anything-but": ["Raining"]}],
+			"channel": [{"anything-but": ["web", "mobile"]}],
+			"region": [{"anything-but": {"prefix": "us-"}}],
+			"file": [{"suffix": {"equals-ignore-case": ".PNG"}}, {"wildcard": "img/*.jpg"}],
+			"name": [{"equals-ignore-case": "alice"}],
+			"ip": [{"cidr": "10.0.0.0/24"}]
+		},
+		"$or": [
+			{"account": ["111122223333"]},
+			{"region": ["eu-north-1"], "resources": [{"exists": true}]}
+		]
+	}`)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `Matches events where:
+  - detail.channel is none of "web", "mobile"
+  - detail.coupon does not exist
+  - detail.file ends with ".PNG", ignoring case, or matches the wildcard "img/*.jpg"
+  - detail.ip is an IP address in 10.0.0.0/24
+  - detail.lastName is empty
+  - detail.name is "alice", ignoring case
+  - detail.price is more than 10 and at most 20, or is 100
+  - detail.productName exists
+  - detail.region does not begin with "us-"
+  - detail.userId is null
+  - detail.weather is anything but "Raining"
+  - detail-type begins with "order."
+  - source is one of "orders", "shipping"
+  - any of:
+    1. all of:
+       - account is "111122223333"
+    2. all of:
+       - region is "eu-north-1"
+       - resources exists
+`, explainPattern(p))
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+)
+
+// EventBridge limits of rule event patterns.
+const (
+	patternMaxLength       = 4096 // PutRule EventPattern
+	patternMaxCombinations = 1000 // combinations of the $or branches
+)
+
+// patternOperators are the comparison operators of event pattern matchers.
+var patternOperators = []string{"anything-but", "cidr", "equals-ignore-case", "exists", "numeric", "prefix", "suffix", "wildcard"}
+
+// eventFields are the top level fields of the events EventBridge delivers.
+var eventFields = []string{"account", "detail", "detail-type", "id", "region", "replay-name", "resources", "source", "time", "version"}
+
+// lintFinding is an issue of an event pattern. Errors are rejected by PutRule, warnings are likely mistakes.
+type lintFinding struct {
+	path    string
+	message string
+	warning bool
+}
+
+func (f lintFinding) String() string {
+	if f.path == "" {
+		return f.message
+	}
+	return f.path + ": " + f.message
+}
+
+type patternLinter struct {
+	findings []lintFinding
+}
+
+func (l *patternLinter) errorf(path, format string, args ...any) {
+	l.findings = append(l.findings, lintFinding{path: path, message: fmt.Sprintf(format, args...)})
+}
+
+func (l *patternLinter) warnf(path, format string, args ...any) {
+	l.findings = append(l.findings, lintFinding{path: path, message: fmt.Sprintf(format, args...), warning: true})
+}
+
+// lintPattern checks a pattern against the EventBridge syntax and limits, without calling AWS.
+func lintPattern(pattern string) []lintFinding {
+	l := &patternLinter{}
+
+	if n := len(pattern); n > patternMaxLength {
+		l.errorf("", "pattern is %d characters long, over the %d characters limit", n, patternMaxLength)
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(pattern), &v); err != nil {
+		l.errorf("", "invalid JSON: %v", err)
+		return l.findings
+	}
+	p, ok := v.(map[string]any)
+	if !ok {
+		l.errorf("", "pattern must be a JSON object, got %s", toJSON(v))
+		return l.findings
+	}
+	if len(p) == 0 {
+		l.errorf("", "empty pattern, at least one field is required")
+		return l.findings
+	}
+
+	l.object(p, "", true)
+
+	if n := patternCombinations(p); n > patternMaxCombinations {
+		l.errorf("", "$or expands to %d combinations, over the %d combinations limit", n, patternMaxCombinations)
+	}
+	return l.findings
+}
+
+func (l *patternLinter) object(obj map[string]any, path string, top bool) {
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		field := joinPath(path, key)
+
+		if key == "$or" {
+			branches, ok := obj[key].([]any)
+			if !ok || len(branches) == 0 {
+				l.errorf(field, "$or must be an array of objects")
+				continue
+			}
+			if len(branches) == 1 {
+				l.warnf(field, "$or has a single branch, its fields can be used directly")
+			}
+			for i, b := range branches {
+				branch, ok := b.(map[string]any)
+				if !ok || len(branch) == 0 {
+					l.errorf(fmt.Sprintf("%s[%d]", field, i), "$or branches must be non empty objects")
+					continue
+				}
+				l.object(branch, path, top)
+			}
+			continue
+		}
+
+		if top && !slices.Contains(eventFields, key) {
+			msg := "not a field of EventBridge events, the pattern never matches"
+			if s := closest(key, eventFields); s != "" {
+				msg += fmt.Sprintf(", did you mean %q?", s)
+			}
+			l.warnf(field, "%s", msg)
+		}
+
+		switch v := obj[key].(type) {
+		case map[string]any:
+			if len(v) == 0 {
+				l.errorf(field, "empty object, at least one field is required")
+				continue
+			}
+			if op := firstOperator(v); op != "" {
+				l.errorf(field, "the %s matcher must be in an array, ie. [%s]", op, toJSON(v))
+				continue
+			}
+			l.object(v, field, false)
+
+		case []any:
+			l.matchers(v, field)
+
+		default:
+			l.errorf(field, "value must be an array, ie. [%s]", toJSON(v))
+		}
+	}
+}
+
+func (l *patternLinter) matchers(matchers []any, field string) {
+	if len(matchers) == 0 {
+		l.errorf(field, "empty array, matches nothing")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, m := range matchers {
+		if key := toJSON(m); seen[key] {
+			l.warnf(field, "duplicate value %s", key)
+		} else {
+			seen[key] = true
+		}
+
+		switch v := m.(type) {
+		case map[string]any:
+			l.operator(v, field)
+		case []any:
+			l.errorf(field, "nested arrays are not allowed, got %s", toJSON(v))
+		}
+	}
+}
+
+func (l *patternLinter) operator(op map[string]any, field string) {
+	if len(op) != 1 {
+		l.errorf(field, "matcher must have exactly one operator, got %s", toJSON(op))
+		return
+	}
+
+	for name, arg := range op {
+		switch name {
+		case "prefix", "suffix":
+			if m, ok := arg.(map[string]any); ok {
+				s, ok := m["equals-ignore-case"].(string)
+				if !ok || len(m) != 1 {
+					l.errorf(field, "%s must be a string or an equals-ignore-case string, got %s", name, toJSON(arg))
+				} else if s == "" {
+					l.warnf(field, "empty %s matches every string", name)
+				}
+				continue
+			}
+			s, ok := arg.(string)
+			if !ok {
+				l.errorf(field, "%s must be a string, got %s", name, toJSON(arg))
+			} else if s == "" {
+				l.warnf(field, "empty %s matches every string", name)
+			}
+
+		case "equals-ignore-case":
+			if _, ok := arg.(string); !ok {
+				l.errorf(field, "equals-ignore-case must be a string, got %s", toJSON(arg))
+			}
+
+		case "wildcard":
+			l.wildcard(arg, field, name)
+
+		case "cidr":
+			s, ok := arg.(string)
+			if !ok {
+				l.errorf(field, "cidr must be a string, got %s", toJSON(arg))
+			} else if _, _, err := net.ParseCIDR(s); err != nil {
+				l.errorf(field, "invalid cidr %q", s)
+			}
+
+		case "exists":
+			if _, ok := arg.(bool); !ok {
+				l.errorf(field, "exists must be true or false, got %s", toJSON(arg))
+			}
+
+		case "numeric":
+			l.numeric(arg, field)
+
+		case "anything-but":
+			l.anythingBut(arg, field)
+
+		default:
+			msg := fmt.Sprintf("unknown operator %q", name)
+			if s := closest(name, patternOperators); s != "" {
+				msg += fmt.Sprintf(", did you mean %q?", s)
+			}
+			l.errorf(field, "%s", msg)
+		}
+	}
+}
+
+func (l *patternLinter) wildcard(arg any, field, name string) {
+	s, ok := arg.(string)
+	if !ok {
+		l.errorf(field, "%s must be a string, got %s", name, toJSON(arg))
+		return
+	}
+	if strings.Contains(s, "**") {
+		l.errorf(field, "%s %q has consecutive wildcard characters", name, s)
+	}
+	if strings.Trim(s, "*") == "" && name == "wildcard" {
+		l.warnf(field, "wildcard %q matches every string", s)
+	}
+}
+
+func (l *patternLinter) anythingBut(arg any, field string) {
+	switch a := arg.(type) {
+	case string, float64:
+		l.defaultSource(field, a)
+
+	case []any:
+		if len(a) == 0 {
+			l.errorf(field, "anything-but must not be empty")
+		}
+		for _, v := range a {
+			switch v.(type) {
+			case string, float64:
+				l.defaultSource(field, v)
+			default:
+				l.errorf(field, "anything-but values must be strings or numbers, got %s", toJSON(v))
+			}
+		}
+
+	case map[string]any:
+		if len(a) != 1 {
+			l.errorf(field, "anything-but must have exactly one operator, got %s", toJSON(a))
+			return
+		}
+		for inner, innerArg := range a {
+			if !slices.Contains([]string{"prefix", "suffix", "equals-ignore-case", "wildcard"}, inner) {
+				l.errorf(field, "anything-but only accepts prefix, suffix, equals-ignore-case or wildcard, got %q", inner)
+				continue
+			}
+			values, ok := innerArg.([]any)
+			if !ok {
+				values = []any{innerArg}
+			}
+			for _, v := range values {
+				if inner == "wildcard" {
+					l.wildcard(v, field, "anything-but wildcard")
+				} else if _, ok := v.(string); !ok {
+					l.errorf(field, "anything-but %s must be a string, got %s", inner, toJSON(v))
+				}
+			}
+		}
+
+	default:
+		l.errorf(field, "anything-but must be a string, a number, an array or an operator, got %s", toJSON(arg))
+	}
+}
+
+// defaultSource warns about the default pattern of the listener, left over in a rule.
+func (l *patternLinter) defaultSource(field string, v any) {
+	if field == "source" && v == namespace {
+		l.warnf(field, "anything-but %q is the %s default pattern, it matches every event of the bus", namespace, namespace)
+	}
+}
+
+// numeric checks the operator/value pairs, and that some number is in the range.
+func (l *patternLinter) numeric(arg any, field string) {
+	conds, ok := arg.([]any)
+	if !ok || len(conds) == 0 || len(conds)%2 != 0 {
+		l.errorf(field, "numeric must be a list of operator/value pairs, got %s", toJSON(arg))
+		return
+	}
+
+	type bound struct {
+		value     float64
+		inclusive bool
+		set       bool
+	}
+	var lower, upper bound
+	for i := 0; i < len(conds); i += 2 {
+		op, _ := conds[i].(string)
+		x, ok := conds[i+1].(float64)
+		if !ok {
+			l.errorf(field, "numeric %s must be followed by a number, got %s", toJSON(conds[i]), toJSON(conds[i+1]))
+			return
+		}
+
+		switch op {
+		case "=":
+			if len(conds) > 2 {
+				l.errorf(field, "numeric = can't be combined with other operators")
+				return
+			}
+		case ">", ">=":
+			if lower.set {
+				l.errorf(field, "numeric has more than one lower bound")
+				return
+			}
+			lower = bound{value: x, inclusive: op == ">=", set: true}
+		case "<", "<=":
+			if upper.set {
+				l.errorf(field, "numeric has more than one upper bound")
+				return
+			}
+			upper = bound{value: x, inclusive: op == "<=", set: true}
+		default:
+			l.errorf(field, "unknown numeric operator %s, expected =, <, <=, > or >=", toJSON(conds[i]))
+			return
+		}
+	}
+
+	if lower.set && upper.set && (lower.value > upper.value || lower.value == upper.value && !(lower.inclusive && upper.inclusive)) {
+		l.errorf(field, "numeric range %s is empty, no number matches", toJSON(conds))
+	}
+}
+
+// patternCombinations counts the combinations a pattern expands to: the product of the $or branches.
+func patternCombinations(obj map[string]any) int {
+	n := 1
+	for key, v := range obj {
+		switch x := v.(type) {
+		case map[string]any:
+			n *= patternCombinations(x)
+		case []any:
+			if key != "$or" {
+				continue
+			}
+			sum := 0
+			for _, b := range x {
+				if branch, ok := b.(map[string]any); ok {
+					sum += patternCombinations(branch)
+				}
+			}
+			n *= max(sum, 1)
+		}
+		// bounded, the limit is far lower
+		n = min(n, patternMaxCombinations*patternMaxCombinations)
+	}
+	return n
+}
+
+// firstOperator returns the operator of an object mistakenly used as a field value, if any.
+func firstOperator(obj map[string]any) string {
+	for _, op := range patternOperators {
+		if _, ok := obj[op]; ok {
+			return op
+		}
+	}
+	return ""
+}
+
+// closest returns the candidate within an edit distance of 2 of s, if any.
+func closest(s string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(s), c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,146 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_lintPattern(t *testing.T) {
+	// 11 branches
+	orBranches := `[{"a":[0]},{"a":[1]},{"a":[2]},{"a":[3]},{"a":[4]},{"a":[5]},{"a":[6]},{"a":[7]},{"a":[8]},{"a":[9]},{"a":[10]}]`
+
+	tests := []struct {
+		name     string
+		pattern  string
+		errors   []string
+		warnings []string
+	}{
+		{
+			name:    "valid",
+			pattern: `{"source":["orders"],"detail":{"total":[{"numeric":[">",0,"<=",100]}],"ip":[{"cidr":"10.0.0.0/24"}],"name":[{"prefix":{"equals-ignore-case":"a"}},{"wildcard":"a*b"},{"anything-but":{"suffix":["x","y"]}}]},"$or":[{"region":["eu-north-1"]},{"account":[{"exists":true}]}]}`,
+		},
+		{
+			name:    "invalid JSON",
+			pattern: `{"source":`,
+			errors:  []string{"invalid JSON: unexpected end of JSON input"},
+		},
+		{
+			name:    "not an object",
+			pattern: `["orders"]`,
+			errors:  []string{`pattern must be a JSON object, got ["orders"]`},
+		},
+		{
+			name:    "empty",
+			pattern: `{}`,
+			errors:  []string{"empty pattern, at least one field is required"},
+		},
+		{
+			name:    "scalar values",
+			pattern: `{"source":"orders","detail":{"kind":{"prefix":"x"},"empty":{}}}`,
+			errors: []string{
+				`detail.empty: empty object, at least one field is required`,
+				`detail.kind: the prefix matcher must be in an array, ie. [{"prefix":"x"}]`,
+				`source: value must be an array, ie. ["orders"]`,
+			},
+		},
+		{
+			name:    "unknown operators",
+			pattern: `{"detail":{"a":[{"exist":true}],"b":[{"startsWith":"x"}],"c":[{"prefix":"x","suffix":"y"}],"d":[["x"]],"e":[]}}`,
+			errors: []string{
+				`detail.a: unknown operator "exist", did you mean "exists"?`,
+				`detail.b: unknown operator "startsWith"`,
+				`detail.c: matcher must have exactly one operator, got {"prefix":"x","suffix":"y"}`,
+				`detail.d: nested arrays are not allowed, got ["x"]`,
+				`detail.e: empty array, matches nothing`,
+			},
+		},
+		{
+			name:    "operator arguments",
+			pattern: `{"detail":{"a":[{"prefix":1}],"b":[{"cidr":"10.0.0.0"}],"c":[{"exists":"yes"}],"d":[{"wildcard":"a**"}],"e":[{"anything-but":[true]}],"f":[{"anything-but":{"exists":true}}],"g":[{"prefix":{"equals":"x"}}]}}`,
+			errors: []string{
+				`detail.a: prefix must be a string, got 1`,
+				`detail.b: invalid cidr "10.0.0.0"`,
+				`detail.c: exists must be true or false, got "yes"`,
+				`detail.d: wildcard "a**" has consecutive wildcard characters`,
+				`detail.e: anything-but values must be strings or numbers, got true`,
+				`detail.f: anything-but only accepts prefix, suffix, equals-ignore-case or wildcard, got "exists"`,
+				`detail.g: prefix must be a string or an equals-ignore-case string, got {"equals":"x"}`,
+			},
+		},
+		{
+			name:    "numeric ranges",
+			pattern: `{"detail":{"a":[{"numeric":[">",10,"<",5]}],"b":[{"numeric":[">",5,"<",5]}],"c":[{"numeric":[">=",5,"<=",5]}],"d":[{"numeric":[">",1,">=",2]}],"e":[{"numeric":["=",1,"<",2]}],"f":[{"numeric":["!=",1]}],"g":[{"numeric":[">"]}],"h":[{"numeric":[">","1"]}]}}`,
+			errors: []string{
+				`detail.a: numeric range [">",10,"<",5] is empty, no number matches`,
+				`detail.b: numeric range [">",5,"<",5] is empty, no number matches`,
+				`detail.d: numeric has more than one lower bound`,
+				`detail.e: numeric = can't be combined with other operators`,
+				`detail.f: unknown numeric operator "!=", expected =, <, <=, > or >=`,
+				`detail.g: numeric must be a list of operator/value pairs, got [">"]`,
+				`detail.h: numeric ">" must be followed by a number, got "1"`,
+			},
+		},
+		{
+			name:     "leftover default",
+			pattern:  `{"source":[{"anything-but":["eventbridge-cli"]}]}`,
+			warnings: []string{`source: anything-but "eventbridge-cli" is the eventbridge-cli default pattern, it matches every event of the bus`},
+		},
+		{
+			name:    "likely mistakes",
+			pattern: `{"detailType":["order.paid"],"source":["orders","orders"],"detail":{"a":[{"prefix":""}],"b":[{"wildcard":"*"}]},"$or":[{"region":["eu-north-1"]}]}`,
+			warnings: []string{
+				`$or: $or has a single branch, its fields can be used directly`,
+				`detail.a: empty prefix matches every string`,
+				`detail.b: wildcard "*" matches every string`,
+				`detailType: not a field of EventBridge events, the pattern never matches, did you mean "detail-type"?`,
+				`source: duplicate value "orders"`,
+			},
+		},
+		{
+			name:    "$or branches",
+			pattern: `{"source":["orders"],"$or":[{},"region"]}`,
+			errors: []string{
+				`$or[0]: $or branches must be non empty objects`,
+				`$or[1]: $or branches must be non empty objects`,
+			},
+		},
+		{
+			name:    "size limit",
+			pattern: `{"source":["` + strings.Repeat("x", patternMaxLength) + `"]}`,
+			errors:  []string{fmt.Sprintf("pattern is %d characters long, over the 4096 characters limit", patternMaxLength+15)},
+		},
+		{
+			name:    "combinations limit",
+			pattern: `{"source":["orders"],"detail":{"$or":` + orBranches + `,"b":{"$or":` + orBranches + `},"c":{"$or":` + orBranches + `}}}`,
+			errors:  []string{"$or expands to 1331 combinations, over the 1000 combinations limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var errs, warnings []string
+			for _, f := range lintPattern(tt.pattern) {
+				if f.warning {
+					warnings = append(warnings, f.String())
+				} else {
+					errs = append(errs, f.String())
+				}
+			}
+			assert.Equal(t, tt.errors, errs)
+			assert.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func Test_closest(t *testing.T) {
+	assert.Equal(t, "detail-type", closest("detailtype", eventFields))
+	assert.Equal(t, "source", closest("Source", eventFields))
+	assert.Equal(t, "", closest("customer", eventFields))
+	assert.Equal(t, 3, editDistance("kitten", "sitting"))
+}
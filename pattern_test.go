@@ -0,0 +1,174 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testEvent = `{
+	"version": "0",
+	"id": "cwe-test",
+	"detail-type": "poc.succeeded",
+	"source": "beta",
+	"account": "123456789012",
+	"time": "2017-04-11T20:11:04Z",
+	"region": "eu-north-1",
+	"resources": ["arn:aws:ec2:eu-north-1:123456789012:instance/i-abc"],
+	"detail": {
+		"channel": "web",
+		"price": 15,
+		"tags": ["a", "b"],
+		"ip": "10.0.0.12",
+		"file": "image.PNG",
+		"empty": null
+	}
+}`
+
+func Test_eventPatternMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+
+		want   bool
+		reason string
+		err    bool
+	}{
+		{name: "equals", pattern: `{"source": ["beta"]}`, want: true},
+		{name: "or", pattern: `{"source": ["alpha", "beta"]}`, want: true},
+		{name: "nested", pattern: `{"source": ["beta"], "detail": {"channel": ["web"]}}`, want: true},
+		{
+			name:    "nested mismatch",
+			pattern: `{"source": ["beta"], "detail": {"channel": ["mobile"]}}`,
+			want:    false,
+			reason:  `detail.channel: "web" does not match ["mobile"]`,
+		},
+		{
+			name:    "missing field",
+			pattern: `{"detail": {"user": ["alice"]}}`,
+			want:    false,
+			reason:  `detail.user: missing does not match ["alice"]`,
+		},
+		{name: "array value", pattern: `{"detail": {"tags": ["b"]}}`, want: true},
+		{name: "null", pattern: `{"detail": {"empty": [null]}}`, want: true},
+		{name: "prefix", pattern: `{"region": [{"prefix": "eu-"}]}`, want: true},
+		{name: "prefix ignore case", pattern: `{"source": [{"prefix": {"equals-ignore-case": "BE"}}]}`, want: true},
+		{name: "suffix", pattern: `{"detail": {"file": [{"suffix": ".PNG"}]}}`, want: true},
+		{name: "equals-ignore-case", pattern: `{"detail-type": [{"equals-ignore-case": "POC.Succeeded"}]}`, want: true},
+		{name: "wildcard", pattern: `{"resources": [{"wildcard": "arn:aws:ec2:*:instance/*"}]}`, want: true},
+		{name: "anything-but", pattern: `{"source": [{"anything-but": ["alpha"]}]}`, want: true},
+		{name: "anything-but scalar", pattern: `{"source": [{"anything-but": "beta"}]}`, want: false, reason: `source: "beta" does not match [{"anything-but":"beta"}]`},
+		{name: "anything-but prefix", pattern: `{"source": [{"anything-but": {"prefix": "al"}}]}`, want: true},
+		{name: "anything-but missing field", pattern: `{"detail": {"user": [{"anything-but": ["x"]}]}}`, want: false, reason: `detail.user: missing does not match [{"anything-but":["x"]}]`},
+		{name: "numeric range", pattern: `{"detail": {"price": [{"numeric": [">", 10, "<=", 20]}]}}`, want: true},
+		{name: "numeric out of range", pattern: `{"detail": {"price": [{"numeric": [">", 20]}]}}`, want: false, reason: `detail.price: 15 does not match [{"numeric":[">",20]}]`},
+		{name: "exists", pattern: `{"detail": {"channel": [{"exists": true}]}}`, want: true},
+		{name: "does not exist", pattern: `{"detail": {"user": [{"exists": false}]}}`, want: true},
+		{name: "cidr", pattern: `{"detail": {"ip": [{"cidr": "10.0.0.0/24"}]}}`, want: true},
+		{name: "$or", pattern: `{"$or": [{"source": ["alpha"]}, {"detail": {"channel": ["web"]}}]}`, want: true},
+		{name: "$or mismatch", pattern: `{"$or": [{"source": ["alpha"]}, {"detail": {"channel": ["app"]}}]}`, want: false, reason: "$or: none of the branches matched"},
+		{name: "scalar pattern value", pattern: `{"source": "beta"}`, err: true},
+		{name: "unknown operator", pattern: `{"source": [{"regex": "b.*"}]}`, err: true},
+		{name: "invalid numeric", pattern: `{"detail": {"price": [{"numeric": [">"]}]}}`, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := parseEventPattern(test.pattern)
+			require.NoError(t, err)
+
+			got, reason, err := p.match(testEvent)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, test.reason, reason)
+		})
+	}
+}
+
+func Test_parseEventPattern(t *testing.T) {
+	_, err := parseEventPattern(`[1, 2]`)
+	assert.Error(t, err)
+
+	_, err = parseEventPattern(`null`)
+	assert.Error(t, err)
+
+	_, err = parseEventPattern(`{"source": ["beta"]}`)
+	assert.NoError(t, err)
+}
+
+func Test_newEventMatcher(t *testing.T) {
+	t.Run("event pattern", func(t *testing.T) {
+		match, err := newEventMatcher(`{"detail": {"channel": ["web"]}}`)
+		require.NoError(t, err)
+		assert.True(t, match(testEvent))
+		assert.False(t, match(`{"detail": {"channel": "app"}}`))
+	})
+
+	t.Run("event pattern from file", func(t *testing.T) {
+		match, err := newEventMatcher("file://testdata/eventpattern.json")
+		require.NoError(t, err)
+		assert.True(t, match(`{"source": "beta", "detail-type": "poc.succeeded", "detail": {"channel": "web"}}`))
+	})
+
+	t.Run("regular expression", func(t *testing.T) {
+		match, err := newEventMatcher(`"channel":\s*"web"`)
+		require.NoError(t, err)
+		assert.True(t, match(testEvent))
+	})
+
+	t.Run("invalid expression", func(t *testing.T) {
+		_, err := newEventMatcher(`(`)
+		assert.Error(t, err)
+	})
+
+	t.Run("malformed event is a logged non-match", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		log.SetOutput(buf)
+		defer log.SetOutput(io.Discard)
+
+		match, err := newEventMatcher(`{"source": ["beta"]}`)
+		require.NoError(t, err)
+		assert.False(t, match(`not json`))
+		assert.Contains(t, buf.String(), "event not matched against --until")
+	})
+}
+
+func Test_eventPatternDiff(t *testing.T) {
+	p, err := parseEventPattern(`{
+		"source": ["beta"],
+		"detail": {"channel": ["mobile"], "price": [{"numeric": [">", 20]}], "user": [{"exists": true}]},
+		"$or": [{"region": ["us-east-1"]}, {"account": ["1"]}]
+	}`)
+	require.NoError(t, err)
+
+	lines, err := p.diff(testEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`- $or: [{"region":["us-east-1"]},{"account":["1"]}]`,
+		`+ $or: none of the branches matched`,
+		`- detail.channel: ["mobile"]`,
+		`+ detail.channel: "web"`,
+		`- detail.price: [{"numeric":[">",20]}]`,
+		`+ detail.price: 15`,
+		`- detail.user: [{"exists":true}]`,
+		`+ detail.user: missing`,
+	}, lines)
+
+	p, err = parseEventPattern(`{"source": ["beta"]}`)
+	require.NoError(t, err)
+	lines, err = p.diff(testEvent)
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+}
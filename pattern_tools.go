@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v3"
+)
+
+// patternFromFlags resolves the pattern given as argument, or with --eventpattern. The AWS config is
+// only loaded for the sources needing it (ie. 'rule://').
+func patternFromFlags(ctx context.Context, cmd *cli.Command) (source, pattern string, err error) {
+	source = cmd.Args().First()
+	if source == "" {
+		source = cmd.String("eventpattern")
+	}
+
+	src, err := dataSourcesFromFlags(cmd, func(ctx context.Context) (aws.Config, error) {
+		return loadAWSConfig(ctx, cmd.String("profile"), cmd.String("region"))
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	pattern, _, err = resolveEventPattern(ctx, src, source)
+	if err != nil {
+		return "", "", &exitError{code: exitInvalidInput, err: err}
+	}
+	return source, pattern, nil
+}
+
+// runPatternFmt prints the canonical form of the pattern, or rewrites its 'file://' source.
+func runPatternFmt(ctx context.Context, cmd *cli.Command) error {
+	source, pattern, err := patternFromFlags(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := formatPattern(pattern, cmd.Bool("prettyjson"))
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+
+	if !cmd.Bool("write") {
+		fmt.Println(formatted)
+		return nil
+	}
+	if !strings.HasPrefix(source, "file://") {
+		return &exitError{code: exitInvalidInput, err: fmt.Errorf("--write needs a 'file://' pattern, got %s", source)}
+	}
+	return os.WriteFile(strings.TrimPrefix(source, "file://"), []byte(formatted+"\n"), 0o644)
+}
+
+// runPatternLint logs the issues of the pattern, failing on errors, or on warnings with --strict.
+func runPatternLint(ctx context.Context, cmd *cli.Command) error {
+	_, pattern, err := patternFromFlags(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	findings := lintPattern(pattern)
+	errs, warnings := logFindings(findings)
+	if errs > 0 || (warnings > 0 && cmd.Bool("strict")) {
+		return &exitError{code: exitInvalidInput, err: fmt.Errorf("pattern lint failed: %d errors, %d warnings", errs, warnings)}
+	}
+	if len(findings) == 0 {
+		log.Printf("%s pattern is valid", color.GreenString("✔"))
+	}
+	return nil
+}
+
+// runPatternExplain prints the events the pattern matches in plain English.
+func runPatternExplain(ctx context.Context, cmd *cli.Command) error {
+	_, pattern, err := patternFromFlags(ctx, cmd)
+	if err != nil {
+		return err
+	}
+
+	if errs, _ := logFindings(lintPattern(pattern)); errs > 0 {
+		return &exitError{code: exitInvalidInput, err: fmt.Errorf("invalid pattern: %d errors", errs)}
+	}
+
+	p, err := parseEventPattern(pattern)
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+	fmt.Print(explainPattern(p))
+	return nil
+}
+
+func logFindings(findings []lintFinding) (errs, warnings int) {
+	for _, f := range findings {
+		if f.warning {
+			warnings++
+			log.Printf("%s %s", color.YellowString("!"), f)
+			continue
+		}
+		errs++
+		log.Printf("%s %s", color.RedString("✘"), f)
+	}
+	return errs, warnings
+}
+
+// formatPattern returns the canonical form of a pattern: sorted keys, and matcher lists sorted and
+// without duplicates. Numeric conditions keep their order.
+func formatPattern(pattern string, pretty bool) (string, error) {
+	var v any
+	if err := json.Unmarshal([]byte(pattern), &v); err != nil {
+		return "", fmt.Errorf("invalid event pattern: %w", err)
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return "", errors.New("invalid event pattern: must be a JSON object")
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(canonicalPattern(v, "")); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// canonicalPattern sorts the lists of a pattern value, key is the field or operator holding it.
+// Objects keys are sorted when encoded.
+func canonicalPattern(v any, key string) any {
+	switch x := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			m[k] = canonicalPattern(e, k)
+		}
+		return m
+
+	case []any:
+		l := make([]any, 0, len(x))
+		for _, e := range x {
+			l = append(l, canonicalPattern(e, ""))
+		}
+		if key == "numeric" {
+			return l
+		}
+
+		slices.SortStableFunc(l, comparePatternValues)
+		return slices.CompactFunc(l, func(a, b any) bool { return toJSON(a) == toJSON(b) })
+	}
+	return v
+}
+
+// comparePatternValues orders null, booleans, numbers, strings then objects.
+func comparePatternValues(a, b any) int {
+	rank := func(v any) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		}
+		return 4
+	}
+	if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+		return c
+	}
+
+	switch x := a.(type) {
+	case float64:
+		return cmp.Compare(x, b.(float64))
+	case string:
+		return cmp.Compare(x, b.(string))
+	}
+	return cmp.Compare(toJSON(a), toJSON(b))
+}
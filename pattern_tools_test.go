@@ -0,0 +1,99 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_formatPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		pretty  bool
+		want    string
+		err     string
+	}{
+		{
+			name:    "sorted keys and values",
+			pattern: `{"source": ["b", "a", "b"], "detail": {"total": [{"numeric": ["<=", 10, ">", 1]}, 5, null, "x", true, {"exists": true}]}, "detail-type": ["order.paid"]}`,
+			want:    `{"detail":{"total":[null,true,5,"x",{"exists":true},{"numeric":["<=",10,">",1]}]},"detail-type":["order.paid"],"source":["a","b"]}`,
+		},
+		{
+			name:    "$or branches",
+			pattern: `{"$or": [{"region": ["us-east-1"]}, {"account": ["1"]}, {"region": ["us-east-1"]}]}`,
+			want:    `{"$or":[{"account":["1"]},{"region":["us-east-1"]}]}`,
+		},
+		{
+			name:    "anything-but values",
+			pattern: `{"source": [{"anything-but": ["<b>", "a"]}]}`,
+			want:    `{"source":[{"anything-but":["<b>","a"]}]}`,
+		},
+		{
+			name:    "pretty",
+			pattern: `{"source":["a"]}`,
+			pretty:  true,
+			want:    "{\n  \"source\": [\n    \"a\"\n  ]\n}",
+		},
+		{
+			name:    "invalid",
+			pattern: `["a"]`,
+			err:     "invalid event pattern: must be a JSON object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatPattern(tt.pattern, tt.pretty)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_patternFromFlags(t *testing.T) {
+	// a profile missing from the AWS config only matters to the sources calling AWS
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	run := func(args ...string) (pattern string, err error) {
+		app := &cli.Command{
+			Name: "fmt",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "profile", Value: "missing"},
+				&cli.StringFlag{Name: "region"},
+				&cli.StringFlag{Name: "eventpattern"},
+				&cli.StringSliceFlag{Name: "var"},
+				&cli.StringSliceFlag{Name: "parameter-overrides"},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				_, pattern, err = patternFromFlags(ctx, cmd)
+				return nil
+			},
+		}
+		require.NoError(t, app.Run(context.Background(), append([]string{"fmt"}, args...)))
+		return pattern, err
+	}
+
+	pattern, err := run(`{"source":["a"]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"source":["a"]}`, pattern)
+
+	pattern, err = run("--eventpattern", "file://testdata/eventpattern.json")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pattern)
+
+	_, err = run("rule://default/BetaRule")
+	assert.ErrorContains(t, err, "missing")
+}
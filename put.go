@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/urfave/cli/v3"
+)
+
+// runPut sends the input events to the bus and prints the ids EventBridge assigned to them.
+func runPut(ctx context.Context, cmd *cli.Command) error {
+	input, err := inputEventFromFlags(cmd)
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+	events, err := parseInputEvents(input)
+	if err != nil {
+		return &exitError{code: exitInvalidInput, err: err}
+	}
+
+	// AWS config
+	awsCfg, err := newAWSConfig(ctx, cmd.String("profile"), cmd.String("region"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("creating eventBridge client for bus [%s]", cmd.String("eventbusname"))
+	ebClient := newEventbridgeClient(awsCfg, cmd.String("eventbusname"), "")
+
+	for _, event := range events {
+		id, err := ebClient.putEvent(ctx, event)
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+	}
+
+	return nil
+}
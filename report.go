@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// ciReport is the machine-readable result of a CI run, written with --report.
+type ciReport struct {
+	Status       string            `json:"status"` // passed, failed or interrupted
+	ExitCode     int               `json:"exitCode"`
+	Error        string            `json:"error,omitempty"`
+	EventPattern string            `json:"eventPattern,omitempty"`
+	RuleArn      string            `json:"ruleArn,omitempty"`
+	InputEvents  []json.RawMessage `json:"inputEvents,omitempty"`
+	Trigger      string            `json:"trigger,omitempty"`
+	Sends        int               `json:"sends"`
+	Events       []json.RawMessage `json:"events"`
+	Duplicates   int               `json:"duplicates"`
+	Redelivered  int               `json:"redelivered"`
+	LastRejected *ciRejection      `json:"lastRejected,omitempty"`
+	Timings      ciTimings         `json:"timings"`
+	Cleanup      ciCleanup         `json:"cleanup"`
+
+	start time.Time
+}
+
+// ciTimings are in milliseconds, zero when the step didn't happen.
+type ciTimings struct {
+	RuleCreation     int64 `json:"ruleCreationMs"`
+	TargetActivation int64 `json:"targetActivationMs"`     // from linking the queue to the first delivery
+	FirstDelivery    int64 `json:"firstDeliveryLatencyMs"` // from sending the delivered event to receiving it
+	Total            int64 `json:"totalMs"`
+}
+
+// ciRejection is the last received event not satisfying the assertions or expected steps.
+type ciRejection struct {
+	Event  json.RawMessage `json:"event"`
+	Reason string          `json:"reason"`
+	Diff   []string        `json:"diff,omitempty"`
+}
+
+type ciCleanup struct {
+	Status string `json:"status"` // deleted, failed or skipped when no resource was created
+	Error  string `json:"error,omitempty"`
+}
+
+func newCIReport() *ciReport {
+	return &ciReport{
+		Events:  []json.RawMessage{},
+		Cleanup: ciCleanup{Status: "skipped"},
+		start:   time.Now(),
+	}
+}
+
+func (r *ciReport) cleanup(err error) {
+	r.Cleanup = ciCleanup{Status: "deleted"}
+	if err != nil {
+		r.Cleanup = ciCleanup{Status: "failed", Error: err.Error()}
+	}
+}
+
+// finish records err as the outcome of the run.
+func (r *ciReport) finish(err error) {
+	r.ExitCode = exitCodeOf(err)
+	if err != nil {
+		r.Status, r.Error = "failed", err.Error()
+	} else if r.Status == "" {
+		r.Status = "passed"
+	}
+	r.Timings.Total = time.Since(r.start).Milliseconds()
+}
+
+// write saves the report as JSON to path.
+func (r *ciReport) write(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// rawJSON embeds s as is when it's valid JSON, as a string otherwise.
+func rawJSON(s string) json.RawMessage {
+	if json.Valid([]byte(s)) {
+		return json.RawMessage(s)
+	}
+	b, _ := json.Marshal(s)
+	return b
+}
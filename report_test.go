@@ -0,0 +1,50 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ciReportWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.json")
+
+	r := newCIReport()
+	r.InputEvents = append(r.InputEvents, rawJSON(`{"source": "beta"}`))
+	r.Events = append(r.Events, rawJSON(testEvent), rawJSON("not json"))
+	r.cleanup(errors.New("queue still exists"))
+	r.finish(ciFailure(exitTimeout, errors.New("didn't receive any event within 1s")))
+	require.NoError(t, r.write(path))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, "failed", got["status"])
+	assert.Equal(t, float64(exitTimeout), got["exitCode"])
+	assert.Equal(t, "CI failed - didn't receive any event within 1s", got["error"])
+	assert.Equal(t, []any{map[string]any{"source": "beta"}}, got["inputEvents"])
+	assert.Equal(t, "not json", got["events"].([]any)[1])
+	assert.Equal(t, map[string]any{"status": "failed", "error": "queue still exists"}, got["cleanup"])
+}
+
+func Test_ciReportStatus(t *testing.T) {
+	r := newCIReport()
+	r.finish(nil)
+	assert.Equal(t, "passed", r.Status)
+	assert.Equal(t, "skipped", r.Cleanup.Status)
+
+	r = newCIReport()
+	r.Status = "interrupted"
+	r.finish(nil)
+	assert.Equal(t, "interrupted", r.Status)
+}
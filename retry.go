@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// retryPolicy configures exponential backoff with jitter between failed attempts.
+type retryPolicy struct {
+	initial     time.Duration // delay before the first retry
+	max         time.Duration // upper bound for a single delay
+	maxAttempts int           // consecutive failures before giving up, 0 retries forever
+}
+
+// maxBackoff bounds every delay, also when the policy has no max.
+const maxBackoff = time.Hour
+
+var defaultRetryPolicy = retryPolicy{
+	initial:     time.Second,
+	max:         time.Minute,
+	maxAttempts: 10,
+}
+
+// backoff returns the delay before retry number attempt (starting at 1).
+// The delay doubles on every attempt, is capped at max (or maxBackoff) and jittered in [d/2, d].
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	if p.initial <= 0 {
+		return 0
+	}
+
+	ceiling := maxBackoff
+	if p.max > 0 && p.max < ceiling {
+		ceiling = p.max
+	}
+
+	d := min(p.initial, ceiling)
+	for i := 1; i < attempt && d < ceiling; i++ {
+		d = min(d*2, ceiling)
+	}
+
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// exhausted reports whether attempt consecutive failures reached the limit.
+func (p retryPolicy) exhausted(attempt int) bool {
+	return p.maxAttempts > 0 && attempt >= p.maxAttempts
+}
+
+type errorKind int
+
+const (
+	errorFatal errorKind = iota
+	errorRetryable
+	errorExpiredCredentials
+	errorQueueDeleted
+)
+
+var (
+	retryables = retry.IsErrorRetryables(retry.DefaultRetryables)
+
+	// error codes not covered by the SDK defaults
+	retryableErrorCodes = map[string]struct{}{
+		"OverLimit":            {},
+		"QueueDeletedRecently": {},
+		"KmsThrottled":         {},
+		"ServiceUnavailable":   {},
+		"InternalError":        {},
+		"InternalFailure":      {},
+	}
+
+	permissionErrorCodes = map[string]struct{}{
+		"AccessDenied":                {},
+		"AccessDeniedException":       {},
+		"AuthorizationError":          {},
+		"UnauthorizedOperation":       {},
+		"UnrecognizedClientException": {},
+		"InvalidClientTokenId":        {},
+		"SignatureDoesNotMatch":       {},
+		"MissingAuthenticationToken":  {},
+	}
+
+	expiredCredentialsErrorCodes = map[string]struct{}{
+		"ExpiredToken":          {},
+		"ExpiredTokenException": {},
+		"TokenRefreshRequired":  {},
+		"RequestExpired":        {},
+	}
+)
+
+// classifyError decides how the poller reacts to an SDK error.
+func classifyError(err error) errorKind {
+	var queueNotFound *types.QueueDoesNotExist
+	if errors.As(err, &queueNotFound) {
+		return errorQueueDeleted
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		if code == "AWS.SimpleQueueService.NonExistentQueue" {
+			return errorQueueDeleted
+		}
+		if _, ok := expiredCredentialsErrorCodes[code]; ok {
+			return errorExpiredCredentials
+		}
+		if _, ok := retryableErrorCodes[code]; ok {
+			return errorRetryable
+		}
+	}
+
+	if isCredentialsError(err) {
+		return errorExpiredCredentials
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errorRetryable
+	}
+
+	if retryables.IsErrorRetryable(err) == aws.TrueTernary {
+		return errorRetryable
+	}
+
+	return errorFatal
+}
+
+// isPermissionError reports whether err is an AWS authentication or authorization failure.
+func isPermissionError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		if _, ok := permissionErrorCodes[code]; ok {
+			return true
+		}
+		if _, ok := expiredCredentialsErrorCodes[code]; ok {
+			return true
+		}
+	}
+
+	return isCredentialsError(err)
+}
+
+// credentialsError is a failure of the credentials provider, ie. an expired SSO session.
+// The SDK wraps provider errors in untyped errors, loadAWSConfig wraps the provider to tell them apart.
+type credentialsError struct {
+	err error
+}
+
+func (e *credentialsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *credentialsError) Unwrap() error {
+	return e.err
+}
+
+// credentialsProvider returns the retrieve errors of the wrapped provider as credentialsError.
+type credentialsProvider struct {
+	aws.CredentialsProvider
+}
+
+func (p credentialsProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	creds, err := p.CredentialsProvider.Retrieve(ctx)
+	if err != nil {
+		return aws.Credentials{}, &credentialsError{err: err}
+	}
+	return creds, nil
+}
+
+// Invalidate expires the cached credentials, when the wrapped provider caches them.
+func (p credentialsProvider) Invalidate() {
+	if c, ok := p.CredentialsProvider.(interface{ Invalidate() }); ok {
+		c.Invalidate()
+	}
+}
+
+// ProviderSources keeps the credential sources reported in the SDK user agent.
+func (p credentialsProvider) ProviderSources() []aws.CredentialSource {
+	if s, ok := p.CredentialsProvider.(aws.CredentialProviderSource); ok {
+		return s.ProviderSources()
+	}
+	return nil
+}
+
+// isCredentialsError reports whether err comes from resolving the AWS credentials.
+func isCredentialsError(err error) bool {
+	var credErr *credentialsError
+	var tokenErr *ssocreds.InvalidTokenError
+	return errors.As(err, &credErr) || errors.As(err, &tokenErr)
+}
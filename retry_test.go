@@ -0,0 +1,165 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_retryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{initial: 100 * time.Millisecond, max: time.Second}
+
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{attempt: 1, min: 50 * time.Millisecond, max: 100 * time.Millisecond},
+		{attempt: 2, min: 100 * time.Millisecond, max: 200 * time.Millisecond},
+		{attempt: 4, min: 400 * time.Millisecond, max: 800 * time.Millisecond},
+		{attempt: 10, min: 500 * time.Millisecond, max: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("attempt %d", test.attempt), func(t *testing.T) {
+			for range 50 {
+				d := p.backoff(test.attempt)
+				assert.GreaterOrEqual(t, d, test.min)
+				assert.LessOrEqual(t, d, test.max)
+			}
+		})
+	}
+
+	t.Run("zero policy does not wait", func(t *testing.T) {
+		assert.Equal(t, time.Duration(0), retryPolicy{}.backoff(3))
+	})
+
+	t.Run("no max is bounded", func(t *testing.T) {
+		d := retryPolicy{initial: time.Second}.backoff(200)
+		assert.GreaterOrEqual(t, d, maxBackoff/2)
+		assert.LessOrEqual(t, d, maxBackoff)
+	})
+
+	t.Run("tiny delay does not panic", func(t *testing.T) {
+		assert.Equal(t, time.Nanosecond, retryPolicy{initial: time.Nanosecond}.backoff(1))
+	})
+}
+
+func Test_retryPolicyExhausted(t *testing.T) {
+	assert.False(t, retryPolicy{maxAttempts: 3}.exhausted(2))
+	assert.True(t, retryPolicy{maxAttempts: 3}.exhausted(3))
+	assert.False(t, retryPolicy{}.exhausted(1000))
+}
+
+func Test_classifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorKind
+	}{
+		{
+			name: "generic error",
+			err:  errors.New("some AWS error"),
+			want: errorFatal,
+		},
+		{
+			name: "access denied",
+			err:  &smithy.GenericAPIError{Code: "AccessDenied"},
+			want: errorFatal,
+		},
+		{
+			name: "throttling",
+			err:  &smithy.GenericAPIError{Code: "ThrottlingException"},
+			want: errorRetryable,
+		},
+		{
+			name: "queue deleted recently",
+			err:  fmt.Errorf("createQueue: %w", &types.QueueDeletedRecently{}),
+			want: errorRetryable,
+		},
+		{
+			name: "expired token",
+			err:  &smithy.GenericAPIError{Code: "ExpiredToken"},
+			want: errorExpiredCredentials,
+		},
+		{
+			name: "credentials provider",
+			err:  fmt.Errorf("get identity: %w", &credentialsError{err: errors.New("the SSO session has expired")}),
+			want: errorExpiredCredentials,
+		},
+		{
+			name: "invalid SSO token",
+			err:  fmt.Errorf("failed to refresh cached credentials, %w", &ssocreds.InvalidTokenError{Err: errors.New("expired")}),
+			want: errorExpiredCredentials,
+		},
+		{
+			name: "credentials wording is not matched",
+			err:  errors.New("failed to refresh cached credentials, the SSO session has expired"),
+			want: errorFatal,
+		},
+		{
+			name: "queue does not exist",
+			err:  &types.QueueDoesNotExist{},
+			want: errorQueueDeleted,
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+			want: errorFatal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, classifyError(test.err))
+		})
+	}
+}
+
+func Test_isPermissionError(t *testing.T) {
+	assert.True(t, isPermissionError(fmt.Errorf("putRule: %w", &smithy.GenericAPIError{Code: "AccessDeniedException"})))
+	assert.True(t, isPermissionError(&smithy.GenericAPIError{Code: "ExpiredToken"}))
+	assert.True(t, isPermissionError(fmt.Errorf("get identity: %w", &credentialsError{err: errors.New("no EC2 IMDS role found")})))
+	assert.False(t, isPermissionError(&smithy.GenericAPIError{Code: "ThrottlingException"}))
+	assert.False(t, isPermissionError(errors.New("some AWS error")))
+}
+
+func Test_exitCodeOf(t *testing.T) {
+	assert.Equal(t, 0, exitCodeOf(nil))
+	assert.Equal(t, 1, exitCodeOf(errors.New("some AWS error")))
+	assert.Equal(t, exitAWSPermission, exitCodeOf(&smithy.GenericAPIError{Code: "AccessDenied"}))
+	assert.Equal(t, exitPatternMismatch, exitCodeOf(fmt.Errorf("wrapped: %w", ciFailure(exitPatternMismatch, errPatternMismatch))))
+	assert.Equal(t, exitStopUntil, exitCodeOf(&exitError{code: exitStopUntil}))
+	assert.Equal(t, exitInvalidInput, exitCodeOf(fmt.Errorf("putRule: %w", &ebtypes.InvalidEventPatternException{Message: aws.String("Event pattern is not valid")})))
+}
+
+func Test_credentialsProvider(t *testing.T) {
+	failing := true
+	cache := aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		if failing {
+			return aws.Credentials{}, errors.New("the SSO session has expired")
+		}
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	}))
+	p := credentialsProvider{cache}
+
+	_, err := p.Retrieve(context.Background())
+	assert.Equal(t, errorExpiredCredentials, classifyError(fmt.Errorf("operation error SQS: ReceiveMessage, %w", err)))
+
+	failing = false
+	p.Invalidate()
+	creds, err := p.Retrieve(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "AKID", creds.AccessKeyID)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// slsMaxDepth bounds the resolution of variables referencing other variables.
+const slsMaxDepth = 10
+
+// sls://serverless.yml/functionName, or sls://serverless.yml/functionName/N for its Nth eventBridge event
+func dataFromServerless(src *dataSources, slspath string) (string, string, error) {
+	file, refs, err := splitTemplatePath(strings.TrimPrefix(slspath, "sls://"))
+	if err != nil {
+		return "", "", err
+	}
+	if len(refs) > 2 {
+		return "", "", fmt.Errorf("invalid sls source %q, expected sls://<serverless.yml>/<function>[/<event_number>]", slspath)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	// CloudFormation resources can use short-form tags
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return "", "", err
+	}
+	expandShortForm(&root)
+
+	var service struct {
+		Functions map[string]struct {
+			Events []struct {
+				EventBridge *struct {
+					EventBus any `yaml:"eventBus"`
+					Pattern  any `yaml:"pattern"`
+				} `yaml:"eventBridge"`
+			} `yaml:"events"`
+		} `yaml:"functions"`
+	}
+	if err := root.Decode(&service); err != nil {
+		return "", "", err
+	}
+	var doc map[string]any
+	if err := root.Decode(&doc); err != nil {
+		return "", "", err
+	}
+
+	function := refs[0]
+	fn, ok := service.Functions[function]
+	if !ok {
+		return "", "", fmt.Errorf("function %s not found in %s", function, file)
+	}
+
+	// schedule only events have no pattern
+	type eventBridge struct{ eventBus, pattern any }
+	var events []eventBridge
+	for _, e := range fn.Events {
+		if e.EventBridge != nil && e.EventBridge.Pattern != nil {
+			events = append(events, eventBridge{e.EventBridge.EventBus, e.EventBridge.Pattern})
+		}
+	}
+
+	var event eventBridge
+	switch {
+	case len(events) == 0:
+		return "", "", fmt.Errorf("function %s has no eventBridge event with a pattern", function)
+	case len(refs) > 1:
+		n, err := strconv.Atoi(refs[1])
+		if err != nil || n < 1 || n > len(events) {
+			return "", "", fmt.Errorf("function %s has no eventBridge event %s, choose one of 1 to %d", function, refs[1], len(events))
+		}
+		event = events[n-1]
+	case len(events) > 1:
+		return "", "", fmt.Errorf("function %s has %d eventBridge events, choose one of 1 to %d: sls://%s/%s/<event_number>", function, len(events), len(events), file, function)
+	default:
+		event = events[0]
+	}
+
+	r := &slsResolver{doc: doc, options: src.options}
+	p, err := r.resolve(event.pattern, 0)
+	if err != nil {
+		return "", "", fmt.Errorf("event pattern: %w", err)
+	}
+	pattern, err := patternJSON(p)
+	if err != nil {
+		return "", "", err
+	}
+
+	if event.eventBus == nil {
+		return pattern, "", nil
+	}
+	// an unresolved bus (ie. a CloudFormation reference) falls back to -b
+	bus, err := r.resolve(event.eventBus, 0)
+	if err != nil {
+		log.Printf("event bus of function %s can't be resolved, using -b: %v", function, err)
+		return pattern, "", nil
+	}
+	name, ok := bus.(string)
+	if !ok {
+		log.Printf("event bus %s of function %s can't be resolved, using -b", toJSON(bus), function)
+		return pattern, "", nil
+	}
+	return pattern, name, nil
+}
+
+// slsResolver resolves the Serverless Framework ${self:...}, ${opt:...}, ${env:...} and ${sls:stage}
+// variables, with their fallbacks (ie. ${opt:stage, 'dev'}).
+// https://www.serverless.com/framework/docs/providers/aws/guide/variables
+type slsResolver struct {
+	doc     map[string]any
+	options map[string]string // --var
+}
+
+// slsVariable matches the innermost variables, nested ones are resolved first.
+var slsVariable = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+func (r *slsResolver) resolve(v any, depth int) (any, error) {
+	if depth > slsMaxDepth {
+		return nil, fmt.Errorf("variables nested more than %d levels, or circular", slsMaxDepth)
+	}
+
+	switch x := v.(type) {
+	case string:
+		return r.resolveString(x, depth)
+
+	case map[string]any:
+		m := make(map[string]any, len(x))
+		for k, e := range x {
+			resolved, err := r.resolve(e, depth)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+
+	case []any:
+		l := make([]any, 0, len(x))
+		for _, e := range x {
+			resolved, err := r.resolve(e, depth)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, resolved)
+		}
+		return l, nil
+	}
+
+	return v, nil
+}
+
+func (r *slsResolver) resolveString(s string, depth int) (any, error) {
+	for {
+		m := slsVariable.FindStringSubmatchIndex(s)
+		if m == nil {
+			return s, nil
+		}
+
+		v, err := r.variable(s[m[2]:m[3]], depth)
+		if err != nil {
+			return nil, err
+		}
+
+		// a value made of a single variable keeps its type, ie. a list
+		if m[0] == 0 && m[1] == len(s) {
+			return v, nil
+		}
+
+		switch v.(type) {
+		case map[string]any, []any:
+			return nil, fmt.Errorf("variable %s is not a string and can't be part of %q", s[m[0]:m[1]], s)
+		}
+		value := fmt.Sprint(v)
+		if before := s[:m[0]]; strings.Count(before, "${") > strings.Count(before, "}") {
+			// the fallback of an enclosing variable, ie. ${opt:region, ${self:provider.region}}
+			value = "'" + value + "'"
+		}
+		s = s[:m[0]] + value + s[m[1]:]
+	}
+}
+
+// variable resolves the first of the comma separated sources with a value.
+func (r *slsResolver) variable(expr string, depth int) (any, error) {
+	for _, source := range strings.Split(expr, ",") {
+		source = strings.TrimSpace(source)
+
+		if len(source) >= 2 && (source[0] == '\'' || source[0] == '"') && source[len(source)-1] == source[0] {
+			return source[1 : len(source)-1], nil
+		}
+		if n, err := strconv.ParseFloat(source, 64); err == nil {
+			return n, nil
+		}
+
+		kind, name, _ := strings.Cut(source, ":")
+		switch kind {
+		case "self":
+			if v, ok := lookupPath(r.doc, name); ok && v != nil {
+				return r.resolve(v, depth+1)
+			}
+		case "opt":
+			if v, ok := r.options[name]; ok {
+				return v, nil
+			}
+		case "env":
+			if v, ok := os.LookupEnv(name); ok {
+				return v, nil
+			}
+		case "sls":
+			if name != "stage" {
+				return nil, fmt.Errorf("variable ${%s} can't be resolved", expr)
+			}
+			return r.variable("opt:stage, self:provider.stage, 'dev'", depth)
+		default:
+			return nil, fmt.Errorf("variable ${%s} can't be resolved, only self, opt, env and sls:stage are supported", expr)
+		}
+	}
+
+	return nil, fmt.Errorf("variable ${%s} has no value, set options with --var", expr)
+}
+
+// lookupPath returns the value at a dot separated path, ie. 'custom.buses.0'.
+func lookupPath(v any, path string) (any, bool) {
+	if path == "" {
+		return v, true
+	}
+	return lookupKeys(v, strings.Split(path, "."))
+}
+
+// lookupKeys returns the value at a path of map keys and list indexes.
+func lookupKeys(v any, keys []string) (any, bool) {
+	for _, key := range keys {
+		switch x := v.(type) {
+		case map[string]any:
+			var ok bool
+			if v, ok = x[key]; !ok {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(x) {
+				return nil, false
+			}
+			v = x[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,139 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dataFromServerless(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		env     map[string]string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "self variables and defaults",
+			source:  "sls://testdata/serverless.yml/paid",
+			pattern: `{"source":["orders","orders.legacy"],"detail-type":["order.paid"],"detail":{"region":["eu-north-1"]}}`,
+			bus:     "orders-dev",
+		},
+		{
+			name:    "opt variables",
+			options: map[string]string{"stage": "prod", "region": "eu-west-1"},
+			source:  "sls://testdata/serverless.yml/paid",
+			pattern: `{"source":["orders","orders.legacy"],"detail-type":["order.paid"],"detail":{"region":["eu-west-1"]}}`,
+			bus:     "orders-prod",
+		},
+		{
+			name:    "env variables",
+			env:     map[string]string{"ORDERS_REGION": "us-east-1"},
+			source:  "sls://testdata/serverless.yml/paid",
+			pattern: `{"source":["orders","orders.legacy"],"detail-type":["order.paid"],"detail":{"region":["us-east-1"]}}`,
+			bus:     "orders-dev",
+		},
+		{
+			name:    "event by number",
+			source:  "sls://testdata/serverless.yml/refunded/1",
+			pattern: `{"source":["orders"],"detail-type":["order.refunded"]}`,
+		},
+		{
+			name:   "several events",
+			source: "sls://testdata/serverless.yml/refunded",
+			err:    "function refunded has 2 eventBridge events, choose one of 1 to 2",
+		},
+		{
+			name:   "event out of range",
+			source: "sls://testdata/serverless.yml/refunded/3",
+			err:    "function refunded has no eventBridge event 3",
+		},
+		{
+			// falls back to -b
+			name:    "CloudFormation event bus",
+			source:  "sls://testdata/serverless.yml/refunded/2",
+			pattern: `{"source":["refunds"]}`,
+		},
+		{
+			name:   "unsupported variable source",
+			source: "sls://testdata/serverless.yml/report",
+			err:    "variable ${ssm:/orders/source} can't be resolved",
+		},
+		{
+			name:   "unset variable",
+			source: "sls://testdata/serverless.yml/missing",
+			err:    "variable ${env:ORDERS_MISSING_SOURCE} has no value",
+		},
+		{
+			name:   "missing function",
+			source: "sls://testdata/serverless.yml/shipped",
+			err:    "function shipped not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			pattern, bus, err := resolveEventPattern(context.Background(), &dataSources{options: tt.options}, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
+
+func Test_slsResolver(t *testing.T) {
+	r := &slsResolver{
+		doc: map[string]any{
+			"a":    "${self:b}",
+			"b":    "${self:a}",
+			"list": []any{"x", "y"},
+			"n":    3,
+		},
+		options: map[string]string{"stage": "prod"},
+	}
+
+	t.Run("nested fallback", func(t *testing.T) {
+		v, err := r.resolve("${opt:missing, ${opt:stage}}-orders", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "prod-orders", v)
+	})
+
+	t.Run("single variable keeps its type", func(t *testing.T) {
+		v, err := r.resolve("${self:list}", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []any{"x", "y"}, v)
+
+		v, err = r.resolve("${self:list.1}", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "y", v)
+
+		v, err = r.resolve("${self:n}", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, v)
+	})
+
+	t.Run("list in a string", func(t *testing.T) {
+		_, err := r.resolve("orders-${self:list}", 0)
+		assert.ErrorContains(t, err, "is not a string")
+	})
+
+	t.Run("circular reference", func(t *testing.T) {
+		_, err := r.resolve("${self:a}", 0)
+		assert.ErrorContains(t, err, "circular")
+	})
+}
@@ -4,29 +4,44 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
-	"net"
+	"slices"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/fatih/color"
 	"github.com/neilotoole/jsoncolor"
 )
 
 const (
 	sqsMaxMessages = 10
 	sqsWaitSeconds = 5
+
+	depthCheckInterval  = 30 * time.Second
+	deleteFlushInterval = 200 * time.Millisecond
+	reorderWindow       = time.Second
 )
 
 type sqsClient struct {
-	client sqsClientAPI
+	client      sqsClientAPI
+	credentials aws.CredentialsProvider
+	retry       retryPolicy
 
 	arn       string
 	queueName string
 	queueURL  string
+	ruleArn   string
+
+	// mu guards queueURL and ruleArn while a deleted queue is recreated
+	mu sync.Mutex
+
+	// err is set by the poller before doneChan is closed
+	err error
 }
 
 type sqsClientAPI interface {
@@ -34,13 +49,16 @@ type sqsClientAPI interface {
 	DeleteQueue(ctx context.Context, params *sqs.DeleteQueueInput, optFns ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error)
 	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
 	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
 }
 
 func newSQSClient(cfg aws.Config, accountID, queueName string) *sqsClient {
 	return &sqsClient{
-		client:    sqs.NewFromConfig(cfg),
-		arn:       fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, queueName),
-		queueName: queueName,
+		client:      sqs.NewFromConfig(cfg),
+		credentials: cfg.Credentials,
+		retry:       defaultRetryPolicy,
+		arn:         fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cfg.Region, accountID, queueName),
+		queueName:   queueName,
 	}
 }
 
@@ -74,9 +92,16 @@ func (s *sqsClient) createQueue(ctx context.Context, ruleArn string) error {
 	}
 
 	s.queueURL = *resp.QueueUrl
+	s.ruleArn = ruleArn
 	return nil
 }
 
+func (s *sqsClient) url() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueURL
+}
+
 func (s *sqsClient) deleteQueue(ctx context.Context) error {
 	_, err := s.client.DeleteQueue(ctx, &sqs.DeleteQueueInput{
 		QueueUrl: aws.String(s.queueURL),
@@ -89,93 +114,372 @@ type pollOptions struct {
 	readyChan  chan struct{} // closed once polling starts; nil to skip
 	prettyJSON bool
 	prefix     string // log prefix for each received message body
+	quiet      bool   // don't log message bodies
 	once       bool   // return after the first received batch (CI mode)
+
+	workers      int  // parallel receive loops, 1 when unset
+	ordered      bool // print messages sorted by SQS sent timestamp instead of as received
+	depthWarning int  // warn when the queue backlog exceeds this many messages, 0 disables
+
+	// onMessage is called with every printed message body; returning true stops polling
+	onMessage func(body string) bool
 }
 
 // pollQueue continuously receives and deletes messages until ctx is cancelled.
-func (s *sqsClient) pollQueue(ctx context.Context, doneChan chan struct{}, prettyJSON bool) {
+func (s *sqsClient) pollQueue(ctx context.Context, doneChan chan struct{}, opts pollOptions) {
 	log.Printf("press ctrl+c to stop")
-	s.poll(ctx, doneChan, pollOptions{prettyJSON: prettyJSON})
+	s.poll(ctx, doneChan, opts)
 }
 
-// pollQueueCI signals readiness via readyChan, then returns after the first batch is received.
-func (s *sqsClient) pollQueueCI(ctx context.Context, doneChan chan struct{}, readyChan chan struct{}, prettyJSON bool) {
+// pollQueueCI signals readiness via readyChan, then returns once onMessage accepts a message,
+// or after the first batch is received if onMessage is nil.
+func (s *sqsClient) pollQueueCI(ctx context.Context, doneChan chan struct{}, readyChan chan struct{}, prettyJSON bool, onMessage func(body string) bool) {
 	s.poll(ctx, doneChan, pollOptions{
 		readyChan:  readyChan,
 		prettyJSON: prettyJSON,
 		prefix:     "received event: ",
-		once:       true,
+		once:       onMessage == nil,
+		onMessage:  onMessage,
 	})
 }
 
+// poll runs opts.workers receive loops feeding a single printer. Received messages are
+// deleted asynchronously in batches.
 func (s *sqsClient) poll(ctx context.Context, doneChan chan struct{}, opts pollOptions) {
 	log.Printf("polling queue %s ...", s.queueURL)
 	defer close(doneChan)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	workers := max(opts.workers, 1)
+	batches := make(chan []types.Message, workers)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.receive(ctx, batches); err != nil {
+				log.Printf("sqs.ReceiveMessage error: %s", err)
+				errOnce.Do(func() { s.err = err })
+				cancel()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(batches)
+	}()
+
+	if opts.depthWarning > 0 {
+		go s.watchDepth(ctx, opts.depthWarning)
+	}
+
+	// deletes outlive the poll context so the last batches are still acknowledged
+	deleter := newBatchDeleter(s)
+	go deleter.run(context.WithoutCancel(ctx))
+
+	// stop the workers and wait for them before signalling done
+	defer func() {
+		cancel()
+		for range batches {
+		}
+		deleter.close()
+	}()
+
 	if opts.readyChan != nil {
 		close(opts.readyChan)
 	}
 
+	// a single ticker, a timer per loop would never fire under steady traffic
+	var flushTick <-chan time.Time
+	if opts.ordered {
+		ticker := time.NewTicker(reorderWindow / 4)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
+	p := &printer{opts: opts, deleter: deleter}
+	for {
+		select {
+		case batch, ok := <-batches:
+			if !ok {
+				p.flush(true)
+				return
+			}
+			if p.add(batch) || opts.once {
+				return
+			}
+
+		case <-flushTick:
+			if p.flush(false) {
+				return
+			}
+		}
+	}
+}
+
+// receive long-polls the queue and sends non-empty batches until ctx is done.
+func (s *sqsClient) receive(ctx context.Context, batches chan<- []types.Message) error {
+	attempt := 0
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
 		}
 
 		resp, err := s.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:              aws.String(s.queueURL),
-			MaxNumberOfMessages:   sqsMaxMessages,
-			WaitTimeSeconds:       sqsWaitSeconds,
-			MessageAttributeNames: []string{"All"},
+			QueueUrl:                    aws.String(s.url()),
+			MaxNumberOfMessages:         sqsMaxMessages,
+			WaitTimeSeconds:             sqsWaitSeconds,
+			MessageAttributeNames:       []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameSentTimestamp},
 		})
 		if err != nil {
 			if ctx.Err() != nil {
-				return
+				return nil
 			}
-			var netErr net.Error
-			if errors.As(err, &netErr) {
-				log.Printf("sqs.ReceiveMessage error: %s", err)
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(10 * time.Second):
-				}
-				continue
+			attempt++
+			if err := s.handleReceiveError(ctx, err, attempt); err != nil {
+				return err
 			}
-			log.Printf("sqs.ReceiveMessage error: %s", err)
-			return
+			continue
 		}
+		attempt = 0
 
 		if len(resp.Messages) == 0 {
 			continue
 		}
 
-		entries := make([]types.DeleteMessageBatchRequestEntry, 0, len(resp.Messages))
-		for _, m := range resp.Messages {
-			entries = append(entries, types.DeleteMessageBatchRequestEntry{
-				Id:            m.MessageId,
-				ReceiptHandle: m.ReceiptHandle,
-			})
+		select {
+		case batches <- resp.Messages:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
 
-			body := *m.Body
-			if opts.prettyJSON {
-				body = colorJSON(body)
-			}
-			log.Printf("%s%s", opts.prefix, body)
+// watchDepth periodically warns when the queue backlog grows over threshold.
+func (s *sqsClient) watchDepth(ctx context.Context, threshold int) {
+	ticker := time.NewTicker(depthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
 
-		_, err = s.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
-			QueueUrl: aws.String(s.queueURL),
-			Entries:  entries,
+		resp, err := s.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(s.url()),
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
 		})
 		if err != nil {
-			log.Printf("sqs.DeleteMessageBatch error: %s", err)
+			continue
 		}
 
-		if opts.once {
-			return
+		depth, err := strconv.Atoi(resp.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+		if err == nil && depth > threshold {
+			log.Printf("%s queue backlog is ~%d messages, consider more --workers", color.YellowString("warning:"), depth)
+		}
+	}
+}
+
+// printer logs received messages, optionally reordered by SQS sent timestamp.
+// In ordered mode messages are held for reorderWindow so late deliveries from
+// other workers can be sorted in. Only printed messages are deleted, the ones
+// left when onMessage asks to stop stay in the queue.
+type printer struct {
+	opts    pollOptions
+	deleter *batchDeleter
+	pending []types.Message
+}
+
+// add prints batch, or queues it in ordered mode. It returns true when onMessage asked to stop.
+func (p *printer) add(batch []types.Message) bool {
+	if !p.opts.ordered {
+		for i, m := range batch {
+			if p.print(m) {
+				p.delete(batch[:i+1])
+				return true
+			}
+		}
+		p.delete(batch)
+		return false
+	}
+	p.pending = append(p.pending, batch...)
+	return false
+}
+
+// flush prints pending messages older than reorderWindow, or all of them if all is set.
+// It returns true when onMessage asked to stop.
+func (p *printer) flush(all bool) bool {
+	slices.SortStableFunc(p.pending, func(a, b types.Message) int {
+		return sentTimestamp(a).Compare(sentTimestamp(b))
+	})
+
+	cutoff := time.Now().Add(-reorderWindow)
+	n := 0
+	for _, m := range p.pending {
+		if !all && sentTimestamp(m).After(cutoff) {
+			break
+		}
+		n++
+		if p.print(m) {
+			p.delete(p.pending[:n])
+			p.pending = nil
+			return true
 		}
 	}
+	p.delete(p.pending[:n])
+	p.pending = p.pending[n:]
+	return false
+}
+
+// delete acknowledges printed messages.
+func (p *printer) delete(printed []types.Message) {
+	if p.deleter != nil && len(printed) > 0 {
+		p.deleter.add(printed)
+	}
+}
+
+func (p *printer) print(m types.Message) bool {
+	body := aws.ToString(m.Body)
+	switch {
+	case p.opts.quiet:
+	case p.opts.prettyJSON:
+		log.Printf("%s%s", p.opts.prefix, colorJSON(body))
+	default:
+		log.Printf("%s%s", p.opts.prefix, body)
+	}
+
+	return p.opts.onMessage != nil && p.opts.onMessage(body)
+}
+
+// sentTimestamp returns the SentTimestamp system attribute, or the zero time if missing.
+func sentTimestamp(m types.Message) time.Time {
+	ms, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// batchDeleter acknowledges received messages asynchronously, packing them in
+// DeleteMessageBatch calls of up to sqsMaxMessages entries.
+type batchDeleter struct {
+	s       *sqsClient
+	entries chan []types.DeleteMessageBatchRequestEntry
+	done    chan struct{}
+}
+
+func newBatchDeleter(s *sqsClient) *batchDeleter {
+	return &batchDeleter{
+		s:       s,
+		entries: make(chan []types.DeleteMessageBatchRequestEntry, 64),
+		done:    make(chan struct{}),
+	}
+}
+
+func (d *batchDeleter) add(batch []types.Message) {
+	entries := make([]types.DeleteMessageBatchRequestEntry, 0, len(batch))
+	for _, m := range batch {
+		entries = append(entries, types.DeleteMessageBatchRequestEntry{
+			Id:            m.MessageId,
+			ReceiptHandle: m.ReceiptHandle,
+		})
+	}
+	d.entries <- entries
+}
+
+// close flushes pending entries and waits for the last delete call.
+func (d *batchDeleter) close() {
+	close(d.entries)
+	<-d.done
+}
+
+func (d *batchDeleter) run(ctx context.Context) {
+	defer close(d.done)
+
+	var pending []types.DeleteMessageBatchRequestEntry
+	flush := func(all bool) {
+		for len(pending) >= sqsMaxMessages || (all && len(pending) > 0) {
+			n := min(len(pending), sqsMaxMessages)
+			d.delete(ctx, pending[:n])
+			pending = pending[n:]
+		}
+	}
+
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entries, ok := <-d.entries:
+			if !ok {
+				flush(true)
+				return
+			}
+			pending = append(pending, entries...)
+			flush(false)
+		case <-ticker.C:
+			flush(true)
+		}
+	}
+}
+
+func (d *batchDeleter) delete(ctx context.Context, entries []types.DeleteMessageBatchRequestEntry) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := d.s.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(d.s.url()),
+		Entries:  entries,
+	})
+	if err != nil {
+		log.Printf("sqs.DeleteMessageBatch error: %s", err)
+	}
+}
+
+// handleReceiveError prepares the next receive attempt after err: it refreshes expired credentials,
+// recreates a queue deleted externally and waits according to the retry policy.
+// A non-nil error means polling can't continue.
+func (s *sqsClient) handleReceiveError(ctx context.Context, err error, attempt int) error {
+	switch classifyError(err) {
+	case errorFatal:
+		return err
+
+	case errorExpiredCredentials:
+		log.Printf("credentials expired, refreshing...")
+		if c, ok := s.credentials.(interface{ Invalidate() }); ok {
+			c.Invalidate()
+		}
+
+	case errorQueueDeleted:
+		log.Printf("queue %s was deleted, recreating...", s.url())
+		s.mu.Lock()
+		createErr := s.createQueue(ctx, s.ruleArn)
+		s.mu.Unlock()
+		if createErr != nil {
+			if classifyError(createErr) == errorFatal {
+				return createErr
+			}
+			err = createErr
+		}
+	}
+
+	if s.retry.exhausted(attempt) {
+		return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+	}
+
+	delay := s.retry.backoff(attempt)
+	log.Printf("sqs.ReceiveMessage error: %s, retrying in %s (attempt %d)", err, delay.Round(time.Millisecond), attempt)
+	select {
+	case <-ctx.Done():
+	case <-time.After(delay):
+	}
+	return nil
 }
 
 func colorJSON(body string) string {
@@ -6,14 +6,18 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,8 +27,19 @@ type mockSQSclient struct {
 	err            error
 	deleteBatchErr error
 
+	// receiveErrs are returned, in order, by the first ReceiveMessage calls
+	receiveErrs       []error
+	createQueueCalled int
+
+	mu             sync.Mutex
+	deletedEntries int
+	deleteCalls    int
+	queueDepth     string
+
 	queueURL        *string
 	receiveMessages []types.Message
+	// receiveOnce returns receiveMessages on the first receive only
+	receiveOnce bool
 }
 
 const (
@@ -40,6 +55,7 @@ func init() {
 }
 
 func (m *mockSQSclient) CreateQueue(ctx context.Context, params *sqs.CreateQueueInput, optFns ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+	m.createQueueCalled++
 	return &sqs.CreateQueueOutput{
 		QueueUrl: m.queueURL,
 	}, m.err
@@ -50,15 +66,36 @@ func (m *mockSQSclient) DeleteQueue(ctx context.Context, params *sqs.DeleteQueue
 }
 
 func (m *mockSQSclient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.receiveErrs) > 0 {
+		err := m.receiveErrs[0]
+		m.receiveErrs = m.receiveErrs[1:]
+		return nil, err
+	}
+	messages := m.receiveMessages
+	if m.receiveOnce {
+		m.receiveMessages = nil
+	}
 	return &sqs.ReceiveMessageOutput{
-		Messages: m.receiveMessages,
+		Messages: messages,
 	}, m.err
 }
 
 func (m *mockSQSclient) DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteCalls++
+	m.deletedEntries += len(params.Entries)
 	return &sqs.DeleteMessageBatchOutput{}, m.deleteBatchErr
 }
 
+func (m *mockSQSclient) GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	return &sqs.GetQueueAttributesOutput{
+		Attributes: map[string]string{"ApproximateNumberOfMessages": m.queueDepth},
+	}, m.err
+}
+
 func Test_createQueue(t *testing.T) {
 	tests := []struct {
 		name string
@@ -77,11 +114,13 @@ func Test_createQueue(t *testing.T) {
 			},
 			want: &sqsClient{
 				client: &mockSQSclient{
-					queueURL: aws.String(queueURL),
+					queueURL:          aws.String(queueURL),
+					createQueueCalled: 1,
 				},
 				arn:       arn,
 				queueName: queueName,
 				queueURL:  queueURL,
+				ruleArn:   ruleArn,
 			},
 			err: false,
 		},
@@ -160,7 +199,7 @@ func Test_pollQueueCancel(t *testing.T) {
 		doneChan := make(chan struct{})
 
 		c := &sqsClient{}
-		go c.pollQueue(ctx, doneChan, false)
+		go c.pollQueue(ctx, doneChan, pollOptions{})
 		cancel()
 		<-doneChan
 	})
@@ -214,7 +253,7 @@ func Test_pollQueue(t *testing.T) {
 				queueURL: queueURL,
 			}
 
-			go client.pollQueue(ctx, doneChan, test.prettyJSON)
+			go client.pollQueue(ctx, doneChan, pollOptions{prettyJSON: test.prettyJSON})
 
 			time.Sleep(2 * time.Second)
 			cancel()
@@ -231,7 +270,7 @@ func Test_pollQueueReceiveError(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueue(context.Background(), doneChan, false)
+		go client.pollQueue(context.Background(), doneChan, pollOptions{})
 
 		select {
 		case <-doneChan:
@@ -257,14 +296,291 @@ func Test_pollQueueReceiveError(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueue(ctx, doneChan, false)
+		go client.pollQueue(ctx, doneChan, pollOptions{})
+
+		time.Sleep(500 * time.Millisecond)
+		cancel()
+		<-doneChan
+	})
+}
+
+func Test_pollQueueRetry(t *testing.T) {
+	throttled := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+	policy := retryPolicy{initial: time.Millisecond, max: 5 * time.Millisecond, maxAttempts: 3}
+
+	t.Run("retryable errors are retried", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		client := &sqsClient{
+			client: &mockSQSclient{
+				receiveErrs: []error{throttled, throttled},
+				receiveMessages: []types.Message{
+					{
+						MessageId: aws.String("test-id"),
+						Body:      aws.String(`{"source":"test"}`),
+					},
+				},
+			},
+			retry:    policy,
+			queueURL: queueURL,
+		}
+
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
+
+		select {
+		case <-doneChan:
+			assert.NoError(t, client.err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout: doneChan not closed after retries")
+		}
+	})
+
+	t.Run("max attempts stops poller with error", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		client := &sqsClient{
+			client:   &mockSQSclient{err: throttled},
+			retry:    policy,
+			queueURL: queueURL,
+		}
+
+		go client.pollQueue(context.Background(), doneChan, pollOptions{})
+
+		select {
+		case <-doneChan:
+			assert.ErrorContains(t, client.err, "giving up after 3 attempts")
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout: doneChan not closed after max attempts")
+		}
+	})
+
+	t.Run("expired credentials are refreshed", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		refreshed := 0
+		creds := aws.NewCredentialsCache(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			refreshed++
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		}))
+		_, err := creds.Retrieve(context.Background())
+		assert.NoError(t, err)
+
+		client := &sqsClient{
+			client: &mockSQSclient{
+				receiveErrs: []error{&smithy.GenericAPIError{Code: "ExpiredTokenException"}},
+				receiveMessages: []types.Message{
+					{
+						MessageId: aws.String("test-id"),
+						Body:      aws.String(`{"source":"test"}`),
+					},
+				},
+			},
+			credentials: creds,
+			retry:       policy,
+			queueURL:    queueURL,
+		}
+
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
+		<-doneChan
+
+		_, err = creds.Retrieve(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, refreshed)
+	})
+
+	t.Run("deleted queue is recreated", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		mock := &mockSQSclient{
+			queueURL:    aws.String(queueURL),
+			receiveErrs: []error{&types.QueueDoesNotExist{}},
+			receiveMessages: []types.Message{
+				{
+					MessageId: aws.String("test-id"),
+					Body:      aws.String(`{"source":"test"}`),
+				},
+			},
+		}
+		client := &sqsClient{
+			client:   mock,
+			retry:    policy,
+			queueURL: queueURL,
+			ruleArn:  ruleArn,
+		}
+
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
+		<-doneChan
+
+		assert.NoError(t, client.err)
+		assert.Equal(t, 1, mock.createQueueCalled)
+	})
+}
+
+func Test_pollQueueWorkers(t *testing.T) {
+	t.Run("multiple workers receive and delete messages", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		doneChan := make(chan struct{})
+		mock := &mockSQSclient{
+			receiveMessages: []types.Message{
+				{
+					MessageId: aws.String("test-id"),
+					Body:      aws.String(`{"source":"test"}`),
+				},
+			},
+		}
+		client := &sqsClient{
+			client:   mock,
+			queueURL: queueURL,
+		}
+
+		go client.pollQueue(ctx, doneChan, pollOptions{workers: 4, depthWarning: 1})
 
 		time.Sleep(500 * time.Millisecond)
 		cancel()
 		<-doneChan
+
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		assert.Positive(t, mock.deletedEntries)
+		// deletes are packed in batches of up to 10 entries, partial batches only on flush ticks
+		assert.LessOrEqual(t, mock.deleteCalls, mock.deletedEntries/sqsMaxMessages+5)
+	})
+
+	t.Run("ordered mode prints every message", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		doneChan := make(chan struct{})
+		client := &sqsClient{
+			client: &mockSQSclient{
+				receiveMessages: []types.Message{
+					{
+						MessageId:  aws.String("test-id"),
+						Body:       aws.String(`{"source":"test"}`),
+						Attributes: map[string]string{"SentTimestamp": "1700000000000"},
+					},
+				},
+			},
+			queueURL: queueURL,
+		}
+
+		go client.pollQueue(ctx, doneChan, pollOptions{workers: 2, ordered: true})
+
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+		<-doneChan
+	})
+
+	t.Run("ordered mode flushes under steady traffic", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		client := &sqsClient{
+			// the mock returns a batch on every receive, without waiting
+			client: &mockSQSclient{
+				receiveMessages: []types.Message{
+					{
+						MessageId:  aws.String("test-id"),
+						Body:       aws.String(`{"source":"test"}`),
+						Attributes: map[string]string{"SentTimestamp": "1700000000000"},
+					},
+				},
+			},
+			queueURL: queueURL,
+		}
+
+		events := 0
+		go client.pollQueue(context.Background(), doneChan, pollOptions{
+			workers: 2,
+			ordered: true,
+			onMessage: func(body string) bool {
+				events++
+				return true
+			},
+		})
+
+		select {
+		case <-doneChan:
+			assert.Equal(t, 1, events)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout: ordered messages never flushed while batches kept arriving")
+		}
 	})
 }
 
+func Test_pollQueueOnMessage(t *testing.T) {
+	t.Run("onMessage stops poller", func(t *testing.T) {
+		doneChan := make(chan struct{})
+		client := &sqsClient{
+			client: &mockSQSclient{
+				receiveMessages: []types.Message{
+					{
+						MessageId: aws.String("test-id"),
+						Body:      aws.String(`{"source":"test"}`),
+					},
+				},
+			},
+			queueURL: queueURL,
+		}
+
+		events := 0
+		go client.pollQueue(context.Background(), doneChan, pollOptions{
+			onMessage: func(body string) bool {
+				events++
+				return events == 3
+			},
+		})
+
+		select {
+		case <-doneChan:
+			assert.Equal(t, 3, events)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout: doneChan not closed after onMessage returned true")
+		}
+	})
+
+	for _, ordered := range []bool{false, true} {
+		t.Run(fmt.Sprintf("unprinted messages are not deleted, ordered %t", ordered), func(t *testing.T) {
+			doneChan := make(chan struct{})
+			mock := &mockSQSclient{
+				receiveMessages: []types.Message{
+					{MessageId: aws.String("1"), Body: aws.String(`{"id":"1"}`), Attributes: map[string]string{"SentTimestamp": "1700000000000"}},
+					{MessageId: aws.String("2"), Body: aws.String(`{"id":"2"}`), Attributes: map[string]string{"SentTimestamp": "1700000000001"}},
+					{MessageId: aws.String("3"), Body: aws.String(`{"id":"3"}`), Attributes: map[string]string{"SentTimestamp": "1700000000002"}},
+				},
+				receiveOnce: true,
+			}
+			client := &sqsClient{client: mock, queueURL: queueURL}
+
+			go client.pollQueue(context.Background(), doneChan, pollOptions{
+				ordered: ordered,
+				// stop on the second message of the first batch
+				onMessage: func(body string) bool { return body == `{"id":"2"}` },
+			})
+			<-doneChan
+
+			mock.mu.Lock()
+			defer mock.mu.Unlock()
+			assert.Equal(t, 2, mock.deletedEntries)
+		})
+	}
+}
+
+func Test_printerFlush(t *testing.T) {
+	msg := func(id string, sent time.Time) types.Message {
+		return types.Message{
+			MessageId:  aws.String(id),
+			Body:       aws.String(id),
+			Attributes: map[string]string{"SentTimestamp": strconv.FormatInt(sent.UnixMilli(), 10)},
+		}
+	}
+	now := time.Now()
+
+	p := &printer{opts: pollOptions{ordered: true}}
+	p.add([]types.Message{msg("recent", now), msg("second", now.Add(-2*time.Second))})
+	p.add([]types.Message{msg("first", now.Add(-3*time.Second))})
+
+	// only messages older than the reorder window are printed, in sent order
+	p.flush(false)
+	assert.Len(t, p.pending, 1)
+	assert.Equal(t, "recent", *p.pending[0].MessageId)
+
+	p.flush(true)
+	assert.Empty(t, p.pending)
+}
+
 func Test_pollQueueCI(t *testing.T) {
 	t.Run("message received closes doneChan", func(t *testing.T) {
 		doneChan := make(chan struct{})
@@ -280,7 +596,7 @@ func Test_pollQueueCI(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false)
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
 
 		select {
 		case <-doneChan:
@@ -298,7 +614,7 @@ func Test_pollQueueCI(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueueCI(ctx, doneChan, make(chan struct{}), false)
+		go client.pollQueueCI(ctx, doneChan, make(chan struct{}), false, nil)
 		cancel()
 
 		select {
@@ -323,7 +639,7 @@ func Test_pollQueueCI(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), true)
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), true, nil)
 
 		select {
 		case <-doneChan:
@@ -340,7 +656,7 @@ func Test_pollQueueCI(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false)
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
 
 		select {
 		case <-doneChan:
@@ -365,7 +681,7 @@ func Test_pollQueueCI(t *testing.T) {
 			queueURL: queueURL,
 		}
 
-		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false)
+		go client.pollQueueCI(context.Background(), doneChan, make(chan struct{}), false, nil)
 
 		select {
 		case <-doneChan:
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v3"
+)
+
+// templateFuncs are the generators available in input event templates.
+var templateFuncs = template.FuncMap{
+	"uuid": func() string {
+		return uuid.New().String()
+	},
+	"now": func() string {
+		return time.Now().UTC().Format(time.RFC3339)
+	},
+	"env": os.Getenv,
+	"randInt": func(lo, hi int) (int, error) {
+		if hi < lo {
+			return 0, fmt.Errorf("randInt: %d is lower than %d", hi, lo)
+		}
+		return lo + rand.IntN(hi-lo+1), nil
+	},
+}
+
+// inputEventFromFlags reads --inputevent and renders its placeholders with the --var variables.
+func inputEventFromFlags(cmd *cli.Command) (string, error) {
+	event, err := resolveInputEvent(cmd.String("inputevent"))
+	if err != nil {
+		return "", err
+	}
+
+	vars, err := parseVars(cmd.StringSlice("var"))
+	if err != nil {
+		return "", err
+	}
+
+	return renderTemplate(event, vars)
+}
+
+// renderTemplate renders a text/template input event: generators such as {{uuid}} and
+// variables as {{.name}}. Events without placeholders are returned unchanged.
+// Placeholders inside JSON strings are escaped once per enclosing string, ie. twice in the
+// escaped detail, so values with quotes or backslashes keep the event valid.
+func renderTemplate(event string, vars map[string]string) (string, error) {
+	if !strings.Contains(event, "{{") {
+		return event, nil
+	}
+
+	t, err := template.New("inputevent").Option("missingkey=error").Funcs(templateFuncs).Parse(event)
+	if err != nil {
+		return "", fmt.Errorf("invalid input event template: %w", err)
+	}
+	escapeActions(t)
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("invalid input event template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// escapeActions pipes the output of the actions inside JSON strings to jsonEscape, with the
+// number of strings they are nested in. Actions outside strings, ie. numbers, are left as is.
+func escapeActions(t *template.Template) {
+	t.Funcs(template.FuncMap{"jsonEscape": jsonEscape})
+
+	depth := 0
+	var walk func(list *parse.ListNode)
+	walk = func(list *parse.ListNode) {
+		if list == nil {
+			return
+		}
+		for _, node := range list.Nodes {
+			switch n := node.(type) {
+			case *parse.TextNode:
+				depth = jsonStringDepth(string(n.Text), depth)
+			case *parse.ActionNode:
+				// declarations print nothing
+				if depth == 0 || len(n.Pipe.Decl) > 0 {
+					continue
+				}
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Pos:      n.Pos,
+					Args: []parse.Node{
+						parse.NewIdentifier("jsonEscape").SetTree(t.Tree).SetPos(n.Pos),
+						&parse.NumberNode{NodeType: parse.NodeNumber, Pos: n.Pos, IsInt: true, Int64: int64(depth), Text: strconv.Itoa(depth)},
+					},
+				})
+			case *parse.IfNode:
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.RangeNode:
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.WithNode:
+				walk(n.List)
+				walk(n.ElseList)
+			}
+		}
+	}
+	walk(t.Tree.Root)
+}
+
+// jsonStringDepth returns how many JSON strings are open after text, starting with depth open.
+// The quotes of a string nested in depth strings are escaped for each of them: ", \" then \\\".
+func jsonStringDepth(text string, depth int) int {
+	backslashes := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			// the string level the quote delimits, once unescaped
+			level := 1
+			for k := backslashes; k%2 == 1; k = (k - 1) / 2 {
+				level++
+			}
+			switch {
+			case level == depth+1:
+				depth++
+			case level <= depth:
+				depth = level - 1
+			}
+		}
+		backslashes = 0
+	}
+	return depth
+}
+
+// jsonEscape escapes the printed value as the content of a JSON string, depth times.
+func jsonEscape(depth int, v any) (string, error) {
+	s := fmt.Sprint(v)
+	for range depth {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(s); err != nil {
+			return "", err
+		}
+		// strip the quotes and the newline
+		s = buf.String()[1 : buf.Len()-2]
+	}
+	return s, nil
+}
+
+// parseVars reads key=value pairs.
+func parseVars(values []string) (map[string]string, error) {
+	vars := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid variable %q, expected key=value", v)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
@@ -0,0 +1,153 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_renderTemplate(t *testing.T) {
+	t.Run("plain event", func(t *testing.T) {
+		got, err := renderTemplate(`{"source": "beta"}`, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"source": "beta"}`, got)
+	})
+
+	t.Run("generators and variables", func(t *testing.T) {
+		t.Setenv("EVENTBRIDGE_CLI_TEST", "from-env")
+
+		got, err := renderTemplate(`{"id": "{{uuid}}", "at": "{{now}}", "n": {{randInt 5 5}}, "env": "{{env "EVENTBRIDGE_CLI_TEST"}}", "v": "{{.customer}}"}`,
+			map[string]string{"customer": "alice"})
+		require.NoError(t, err)
+
+		var ev map[string]any
+		require.NoError(t, json.Unmarshal([]byte(got), &ev))
+		_, err = uuid.Parse(ev["id"].(string))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, ev["at"])
+		assert.Equal(t, float64(5), ev["n"])
+		assert.Equal(t, "from-env", ev["env"])
+		assert.Equal(t, "alice", ev["v"])
+	})
+
+	t.Run("unique per render", func(t *testing.T) {
+		a, err := renderTemplate(`{{uuid}}`, nil)
+		require.NoError(t, err)
+		b, err := renderTemplate(`{{uuid}}`, nil)
+		require.NoError(t, err)
+		assert.NotEqual(t, a, b)
+	})
+
+	t.Run("fixture", func(t *testing.T) {
+		event, err := resolveInputEvent("file://testdata/event_template.json")
+		require.NoError(t, err)
+		got, err := renderTemplate(event, map[string]string{"customer": "alice"})
+		require.NoError(t, err)
+
+		ev, err := parseInputEvent(got)
+		require.NoError(t, err)
+		assert.True(t, json.Valid([]byte(ev.Detail)), ev.Detail)
+		assert.Contains(t, ev.Detail, `"customer": "alice"`)
+	})
+
+	t.Run("values are escaped", func(t *testing.T) {
+		value := `say "hi" \ bye`
+		t.Setenv("EVENTBRIDGE_CLI_TEST", value)
+
+		got, err := renderTemplate(`{"source": "{{.customer}}", "detail-type": "{{env "EVENTBRIDGE_CLI_TEST"}}", "detail": "{\"customer\": \"{{.customer}}\", \"quantity\": {{randInt 3 3}}}"}`,
+			map[string]string{"customer": value})
+		require.NoError(t, err)
+
+		ev, err := parseInputEvent(got)
+		require.NoError(t, err)
+		assert.Equal(t, value, ev.Source)
+		assert.Equal(t, value, ev.DetailType)
+
+		var detail map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Detail), &detail), ev.Detail)
+		assert.Equal(t, value, detail["customer"])
+		assert.Equal(t, float64(3), detail["quantity"])
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := renderTemplate(`{{.missing}}`, map[string]string{})
+		assert.Error(t, err)
+
+		_, err = renderTemplate(`{{randInt 10 1}}`, nil)
+		assert.Error(t, err)
+
+		_, err = renderTemplate(`{{unknown}}`, nil)
+		assert.Error(t, err)
+	})
+}
+
+func Test_jsonStringDepth(t *testing.T) {
+	tests := []struct {
+		text  string
+		depth int
+		want  int
+	}{
+		{text: `{"n": `, want: 0},
+		{text: `{"id": "`, want: 1},
+		{text: `{"detail": "{\"id\": \"`, want: 2},
+		{text: `{"detail": "{\"id\": \"a\\\"b\\\"`, want: 2},
+		{text: `{"detail": "{\"n\": `, want: 1},
+		{text: `\", \"n\": `, depth: 2, want: 1},
+		{text: `"}`, depth: 2, want: 0},
+		{text: `{"path": "C:\\`, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			assert.Equal(t, test.want, jsonStringDepth(test.text, test.depth))
+		})
+	}
+}
+
+func Test_parseVars(t *testing.T) {
+	vars, err := parseVars([]string{"customer=alice", "query=a=b"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"customer": "alice", "query": "a=b"}, vars)
+
+	_, err = parseVars([]string{"customer"})
+	assert.Error(t, err)
+
+	_, err = parseVars([]string{"=alice"})
+	assert.Error(t, err)
+}
+
+func Test_disableSliceFlagSeparator(t *testing.T) {
+	var got []string
+	record := func(_ context.Context, cmd *cli.Command) error {
+		got = cmd.StringSlice("var")
+		return nil
+	}
+	app := &cli.Command{
+		Name:  namespace,
+		Flags: []cli.Flag{&cli.StringSliceFlag{Name: "var"}},
+		Commands: []*cli.Command{
+			{Name: "wait", Action: record},
+			{Name: "pattern", Commands: []*cli.Command{{Name: "fmt", Action: record}}},
+		},
+	}
+	disableSliceFlagSeparator(app)
+
+	// root flags given after a subcommand are parsed by it
+	for _, args := range [][]string{
+		{"--var", "tags=a,b", "wait"},
+		{"wait", "--var", "tags=a,b"},
+		{"pattern", "fmt", "--var", "tags=a,b"},
+	} {
+		got = nil
+		require.NoError(t, app.Run(context.Background(), append([]string{namespace}, args...)))
+		assert.Equal(t, []string{"tags=a,b"}, got, args)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// tfEventRuleType is the Terraform resource type of EventBridge rules.
+const tfEventRuleType = "aws_cloudwatch_event_rule"
+
+// tfShow is the subset of 'terraform show -json' read by the 'tf://' source, for a state or a plan.
+// https://developer.hashicorp.com/terraform/internals/json-format
+type tfShow struct {
+	Values        *tfValues `json:"values"`
+	PlannedValues *tfValues `json:"planned_values"`
+}
+
+type tfValues struct {
+	RootModule tfModule `json:"root_module"`
+}
+
+type tfModule struct {
+	Address      string       `json:"address"`
+	Resources    []tfResource `json:"resources"`
+	ChildModules []tfModule   `json:"child_modules"`
+}
+
+type tfResource struct {
+	Address string `json:"address"`
+	Mode    string `json:"mode"`
+	Type    string `json:"type"`
+	Values  struct {
+		EventPattern *string `json:"event_pattern"`
+		EventBusName string  `json:"event_bus_name"`
+	} `json:"values"`
+}
+
+// resources returns the resources of the module and of its child modules.
+func (m tfModule) resources() []tfResource {
+	resources := slices.Clone(m.Resources)
+	for _, c := range m.ChildModules {
+		resources = append(resources, c.resources()...)
+	}
+	return resources
+}
+
+// tf://plan.json/module.orders.aws_cloudwatch_event_rule.paid
+func dataFromTerraform(tfpath string) (string, string, error) {
+	file, refs, err := splitTemplatePath(strings.TrimPrefix(tfpath, "tf://"))
+	if err != nil {
+		return "", "", err
+	}
+	address := strings.Join(refs, "/")
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", "", err
+	}
+
+	show := &tfShow{}
+	if err := json.Unmarshal(content, show); err != nil {
+		return "", "", fmt.Errorf("invalid terraform show output %s: %w", file, err)
+	}
+
+	// a plan has the values after apply, a state its current values
+	values := show.PlannedValues
+	if values == nil {
+		values = show.Values
+	}
+	if values == nil {
+		return "", "", fmt.Errorf("%s has no values, expected the output of 'terraform show -json'", file)
+	}
+
+	var rules []string
+	for _, r := range values.RootModule.resources() {
+		if r.Mode != "managed" {
+			continue
+		}
+		if r.Address != address {
+			if r.Type == tfEventRuleType {
+				rules = append(rules, r.Address)
+			}
+			continue
+		}
+
+		if r.Type != tfEventRuleType {
+			return "", "", fmt.Errorf("resource %s is of type %s, expected %s", address, r.Type, tfEventRuleType)
+		}
+		if r.Values.EventPattern == nil {
+			return "", "", fmt.Errorf("rule %s has no event pattern, either a schedule rule or not known until apply", address)
+		}
+		return *r.Values.EventPattern, r.Values.EventBusName, nil
+	}
+
+	slices.Sort(rules)
+	return "", "", fmt.Errorf("resource %s not found in %s, choose one of: %s", address, file, strings.Join(rules, ", "))
+}
@@ -0,0 +1,73 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_dataFromTerraform(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		pattern string
+		bus     string
+		err     string
+	}{
+		{
+			name:    "state",
+			source:  "tf://testdata/terraform/state.json/aws_cloudwatch_event_rule.beta",
+			pattern: `{"source":["beta"],"detail":{"channel":["web"]}}`,
+			bus:     "fishnchips-eventbus",
+		},
+		{
+			name:    "plan child module",
+			source:  "tf://testdata/terraform/plan.json/module.orders.aws_cloudwatch_event_rule.paid",
+			pattern: `{"source":["orders"],"detail-type":["order.paid"]}`,
+			bus:     "orders-eventbus",
+		},
+		{
+			name:    "nested module instance",
+			source:  `tf://testdata/terraform/plan.json/module.orders.module.refunds.aws_cloudwatch_event_rule.refunded["eu"]`,
+			pattern: `{"source":["orders"],"detail-type":["order.refunded"],"region":["eu-north-1"]}`,
+			bus:     "default",
+		},
+		{
+			name:   "schedule rule",
+			source: "tf://testdata/terraform/plan.json/aws_cloudwatch_event_rule.nightly",
+			err:    "rule aws_cloudwatch_event_rule.nightly has no event pattern",
+		},
+		{
+			name:   "not a rule",
+			source: "tf://testdata/terraform/plan.json/aws_cloudwatch_event_bus.orders",
+			err:    "resource aws_cloudwatch_event_bus.orders is of type aws_cloudwatch_event_bus",
+		},
+		{
+			name:   "missing rule lists the rules",
+			source: "tf://testdata/terraform/plan.json/aws_cloudwatch_event_rule.paid",
+			err:    `choose one of: aws_cloudwatch_event_rule.nightly, module.orders.aws_cloudwatch_event_rule.paid, module.orders.module.refunds.aws_cloudwatch_event_rule.refunded["eu"]`,
+		},
+		{
+			name:   "not a terraform show output",
+			source: "tf://testdata/eventpattern.json/aws_cloudwatch_event_rule.beta",
+			err:    "expected the output of 'terraform show -json'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, bus, err := resolveEventPattern(context.Background(), &dataSources{}, tt.source)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.pattern, pattern)
+			assert.Equal(t, tt.bus, bus)
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// runWait signals readiness, then blocks until an event matching the pattern is delivered
+// and prints it on stdout. The event is emitted by something else: a lambda, a step
+// function, the aws cli or the --then command.
+func runWait(ctx context.Context, cmd *cli.Command, l *listener) error {
+	log.Printf("wait mode")
+
+	timeout := time.Duration(cmd.Int64("timeout")) * time.Second
+	pollCtx, cancelPoll := context.WithTimeout(ctx, timeout)
+	defer cancelPoll()
+
+	var event string
+	signalChan := make(chan os.Signal, 1)
+	doneChan := make(chan struct{})
+	readyChan := make(chan struct{})
+	signal.Notify(signalChan, os.Interrupt)
+	defer signal.Stop(signalChan)
+	go l.sqs.pollQueueCI(pollCtx, doneChan, readyChan, cmd.Bool("prettyjson"), func(body string) bool {
+		event = body
+		return true
+	})
+
+	// wait for poller to start before signalling readiness
+	<-readyChan
+	if f := cmd.String("ready-file"); f != "" {
+		if err := os.WriteFile(f, []byte(l.sqs.queueURL+"\n"), 0o644); err != nil {
+			cancelPoll()
+			<-doneChan
+			return err
+		}
+		defer os.Remove(f)
+	}
+	fmt.Fprintln(os.Stderr, "ready")
+
+	var thenChan chan error
+	command := cmd.String("then")
+	if command != "" {
+		// not bound to the poller, so it isn't killed once the event arrives
+		thenCtx, cancelThen := context.WithTimeout(ctx, timeout)
+		defer cancelThen()
+		thenChan = make(chan error, 1)
+		go func() {
+			log.Printf("running: %s", command)
+			c := shellCommand(thenCtx, command)
+			// keep stdout for the received event
+			c.Stdout, c.Stderr = os.Stderr, os.Stderr
+			start := time.Now()
+			err := c.Run()
+			log.Printf("--then exited with code %d in %s", exitCode(err), time.Since(start).Round(time.Millisecond))
+			thenChan <- err
+		}()
+	}
+	thenFailed := func(err error) error {
+		return fmt.Errorf("wait failed - --then %q exited with code %d: %w", command, exitCode(err), err)
+	}
+
+	for {
+		select {
+		case <-doneChan:
+			if l.sqs.err != nil {
+				return fmt.Errorf("wait failed - poller stopped: %w", l.sqs.err)
+			}
+			if event == "" {
+				return &exitError{code: exitTimeout, err: fmt.Errorf("wait failed - didn't receive any event within %s", timeout)}
+			}
+			fmt.Println(event)
+			// the event can be delivered while the command is still running
+			if thenChan != nil {
+				if err := <-thenChan; err != nil {
+					return thenFailed(err)
+				}
+			}
+			return nil
+		case err := <-thenChan:
+			if err != nil {
+				cancelPoll()
+				<-doneChan
+				return thenFailed(err)
+			}
+			thenChan = nil
+		case <-signalChan:
+			log.Printf("received an interrupt, stopping...")
+			cancelPoll()
+			<-doneChan
+			return &exitError{code: exitInterrupted, err: fmt.Errorf("wait interrupted before an event was received")}
+		}
+	}
+}
+
+// shellCommand runs command through the platform shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+)
+
+func Test_runWaitThen(t *testing.T) {
+	wait := func(then string) error {
+		mock := &mockSQSclient{
+			receiveMessages: []types.Message{{Body: aws.String(`{"id": "1"}`), ReceiptHandle: aws.String("1")}},
+		}
+		l := &listener{sqs: &sqsClient{client: mock, queueURL: queueURL}}
+
+		var err error
+		app := &cli.Command{
+			Name: "wait",
+			Flags: []cli.Flag{
+				&cli.Int64Flag{Name: "timeout", Value: 5},
+				&cli.StringFlag{Name: "then"},
+			},
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				err = runWait(ctx, cmd, l)
+				return nil
+			},
+		}
+		require.NoError(t, app.Run(context.Background(), []string{"wait", "--then", then}))
+		return err
+	}
+
+	// the event arrives before the command exits
+	assert.NoError(t, wait("sleep 0.2"))
+
+	err := wait("sleep 0.2; exit 3")
+	assert.EqualError(t, err, `wait failed - --then "sleep 0.2; exit 3" exited with code 3: exit status 3`)
+	assert.Equal(t, 1, exitCodeOf(err))
+}